@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	_ "time/tzdata" // Embedded zone database for generation time zones on hosts without tzdata
 
 	"insightsim/internal/config"
 	"insightsim/internal/database"
@@ -15,6 +17,11 @@ import (
 )
 
 func main() {
+	// "server scenario ..." validates or runs scenario files without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "scenario" {
+		os.Exit(runScenarioCommand(os.Args[2:]))
+	}
+
 	// Parse command line flags
 	configPath := flag.String("config", "config.json", "Path to config file")
 	dbPath := flag.String("db", "", "Path to SQLite database file (overrides config)")
@@ -41,6 +48,7 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	db.SetWriteBatchSize(cfg.Database.WriteBatchSize)
 
 	log.Printf("Database initialized at: %s", cfg.Database.Path)
 
@@ -48,37 +56,37 @@ func main() {
 	loader := services.NewLoader(db)
 	queryService := services.NewQueryService(db)
 	generator := services.NewGenerator(db)
+	generator.SetWorkers(cfg.Data.GenerationWorkers)
+	jobManager := services.NewJobManager(generator)
 	uploadService := services.NewUploadService(db)
 	tagsService := services.NewTagsService(db)
-
-	// Get value range from config (with defaults)
-	minValue := 1.0
-	maxValue := 10000.0
-	if cfg.Data.ValueRange != nil {
-		minValue = cfg.Data.ValueRange.Min
-		maxValue = cfg.Data.ValueRange.Max
-	}
-
-	// Get sequential generation flag from config (default: false)
+	anomalyService := services.NewAnomalyService(db)
+	calculatedService := services.NewCalculatedTagService(db)
+	fitService := services.NewFitService(db)
+	liveService := services.NewLiveService(db)
+	replayService := services.NewReplayService(db)
+	scenarioService := services.NewScenarioService(db)
+
+	// Generation defaults from config: value range, time range, model, seed and time zone
+	defaults := generationDefaults(cfg)
+	minValue, maxValue := defaults.MinValue, defaults.MaxValue
 	useSequential := cfg.Data.UseSequentialGeneration
-
-	// Get generation time range from config (with defaults)
-	startTime := cfg.Data.GenerationStartTime
-	endTime := cfg.Data.GenerationEndTime
-	if startTime == "" {
-		startTime = "2025-12-01T00:00:00"
-	}
-	if endTime == "" {
-		endTime = "2026-01-31T23:59:59"
-	}
+	startTime, endTime := defaults.StartTime, defaults.EndTime
 
 	// Initialize handlers with config
 	loadHandler := handlers.NewLoadHandler(loader, cfg.Data.RawDataFolder)
 	queryHandler := handlers.NewQueryHandler(queryService)
-	generatorHandler := handlers.NewGeneratorHandler(generator, minValue, maxValue, useSequential, startTime, endTime)
+	generatorHandler := handlers.NewGeneratorHandler(jobManager, minValue, maxValue, useSequential, startTime, endTime, cfg.Data.GenerationSeed, cfg.Data.GenerationTimeZone)
 	configHandler := handlers.NewConfigHandler(minValue, maxValue)
 	uploadHandler := handlers.NewUploadHandler(uploadService)
 	tagsHandler := handlers.NewTagsHandler(tagsService)
+	anomaliesHandler := handlers.NewAnomaliesHandler(anomalyService)
+	calculatedHandler := handlers.NewCalculatedTagsHandler(calculatedService)
+	fitHandler := handlers.NewFitHandler(fitService)
+	liveHandler := handlers.NewLiveHandler(liveService, minValue, maxValue, useSequential, cfg.Data.GenerationSeed, cfg.Data.GenerationTimeZone)
+	replayHandler := handlers.NewReplayHandler(replayService, cfg.Data.GenerationTimeZone)
+	jobsHandler := handlers.NewJobsHandler(jobManager)
+	scenarioHandler := handlers.NewScenarioHandler(scenarioService, jobManager, defaults)
 
 	// Setup router
 	router := mux.NewRouter()
@@ -88,11 +96,36 @@ func main() {
 	api.HandleFunc("/config", configHandler.Handle).Methods("GET")
 	api.HandleFunc("/load", loadHandler.Handle).Methods("POST")
 	api.HandleFunc("/generate-dummy", generatorHandler.Handle).Methods("POST")
+	api.HandleFunc("/jobs", generatorHandler.HandleSubmit).Methods("POST")
+	api.HandleFunc("/jobs", jobsHandler.HandleList).Methods("GET")
+	api.HandleFunc("/jobs/{id}", jobsHandler.HandleGet).Methods("GET")
+	api.HandleFunc("/jobs/{id}", jobsHandler.HandleDelete).Methods("DELETE")
+	api.HandleFunc("/jobs/{id}/events", jobsHandler.HandleEvents).Methods("GET")
+	api.HandleFunc("/scenarios/run", scenarioHandler.HandleRun).Methods("POST")
 	api.HandleFunc("/upload-csv", uploadHandler.Handle).Methods("POST")
 	api.HandleFunc("/tags/names", tagsHandler.HandleListNames).Methods("GET")
 	api.HandleFunc("/tags", tagsHandler.HandleGet).Methods("GET")
 	api.HandleFunc("/tags", tagsHandler.HandleDelete).Methods("DELETE")
 	api.HandleFunc("/tags", tagsHandler.HandlePost).Methods("POST")
+	api.HandleFunc("/tags/{tag}/profile", tagsHandler.HandleGetProfile).Methods("GET")
+	api.HandleFunc("/tags/{tag}/profile", tagsHandler.HandlePutProfile).Methods("PUT")
+	api.HandleFunc("/tags/{tag}/profile", tagsHandler.HandleDeleteProfile).Methods("DELETE")
+	api.HandleFunc("/tags/{tag}/fit", fitHandler.HandlePost).Methods("POST")
+	api.HandleFunc("/tags/{tag}/fit", fitHandler.HandleGet).Methods("GET")
+	api.HandleFunc("/tags/{tag}/fit", fitHandler.HandleDelete).Methods("DELETE")
+	api.HandleFunc("/anomalies", anomaliesHandler.Handle).Methods("GET")
+	api.HandleFunc("/calculated-tags", calculatedHandler.HandleList).Methods("GET")
+	api.HandleFunc("/calculated-tags", calculatedHandler.HandlePost).Methods("POST")
+	api.HandleFunc("/calculated-tags/{tag}", calculatedHandler.HandlePut).Methods("PUT")
+	api.HandleFunc("/calculated-tags/{tag}", calculatedHandler.HandleDelete).Methods("DELETE")
+	api.HandleFunc("/live", liveHandler.HandleList).Methods("GET")
+	api.HandleFunc("/live", liveHandler.HandlePost).Methods("POST")
+	api.HandleFunc("/live/{id}", liveHandler.HandleGet).Methods("GET")
+	api.HandleFunc("/live/{id}", liveHandler.HandleDelete).Methods("DELETE")
+	api.HandleFunc("/replay", replayHandler.HandleList).Methods("GET")
+	api.HandleFunc("/replay", replayHandler.HandlePost).Methods("POST")
+	api.HandleFunc("/replay/{id}", replayHandler.HandleGet).Methods("GET")
+	api.HandleFunc("/replay/{id}", replayHandler.HandleDelete).Methods("DELETE")
 	// Handle timeseriesdata with flexible path matching
 	api.PathPrefix("/timeseriesdata/").HandlerFunc(queryHandler.Handle).Methods("GET")
 
@@ -123,15 +156,66 @@ func main() {
 	log.Printf("  GET  /api/config")
 	log.Printf("  POST /api/load")
 	log.Printf("  POST /api/generate-dummy")
+	log.Printf("  GET|POST /api/jobs")
+	log.Printf("  GET|DELETE /api/jobs/{id}")
+	log.Printf("  GET  /api/jobs/{id}/events")
+	log.Printf("  POST /api/scenarios/run")
 	log.Printf("  POST /api/upload-csv")
 	log.Printf("  GET  /api/timeseriesdata/{start}/{end}?tags=<tag1,tag2>")
 	log.Printf("  GET  /api/tags")
 	log.Printf("  DELETE /api/tags?tag=<name>")
 	log.Printf("  GET  /api/tags/names")
 	log.Printf("  POST /api/tags")
+	log.Printf("  GET|PUT|DELETE /api/tags/{tag}/profile")
+	log.Printf("  GET|POST|DELETE /api/tags/{tag}/fit")
+	log.Printf("  GET  /api/anomalies?tags=<tag1,tag2>&type=<type>&start=<start>&end=<end>")
+	log.Printf("  GET|POST /api/calculated-tags")
+	log.Printf("  PUT|DELETE /api/calculated-tags/{tag}")
+	log.Printf("  GET|POST /api/live")
+	log.Printf("  GET|DELETE /api/live/{id}")
+	log.Printf("  GET|POST /api/replay")
+	log.Printf("  GET|DELETE /api/replay/{id}")
 	log.Printf("  GET  /health")
 
 	if err := http.ListenAndServe(addr, corsMiddleware(router)); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// generationDefaults returns the configured generation settings (with defaults) that
+// requests and scenarios may override
+func generationDefaults(cfg *config.Config) services.GenerateOptions {
+	// Get value range from config (with defaults)
+	minValue := 1.0
+	maxValue := 10000.0
+	if cfg.Data.ValueRange != nil {
+		minValue = cfg.Data.ValueRange.Min
+		maxValue = cfg.Data.ValueRange.Max
+	}
+
+	// Get generation time range from config (with defaults)
+	startTime := cfg.Data.GenerationStartTime
+	endTime := cfg.Data.GenerationEndTime
+	if startTime == "" {
+		startTime = "2025-12-01T00:00:00"
+	}
+	if endTime == "" {
+		endTime = "2026-01-31T23:59:59"
+	}
+
+	// Sequential generation flag from config selects the default model (default: random)
+	model := services.SignalSpec{Type: services.SignalRandom}
+	if cfg.Data.UseSequentialGeneration {
+		model.Type = services.SignalSequential
+	}
+
+	return services.GenerateOptions{
+		MinValue:  minValue,
+		MaxValue:  maxValue,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Model:     model,
+		Seed:      cfg.Data.GenerationSeed,
+		TimeZone:  cfg.Data.GenerationTimeZone,
+	}
+}
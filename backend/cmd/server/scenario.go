@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"insightsim/internal/config"
+	"insightsim/internal/database"
+	"insightsim/internal/services"
+)
+
+const scenarioUsage = `Usage:
+  server scenario validate <file>...
+  server scenario run [-config config.json] [-db path] <file>...
+
+validate checks scenario files and lists every invalid field.
+run creates the scenario tags and profiles and generates their data into the database.
+`
+
+// runScenarioCommand runs the "scenario" subcommand and returns the process exit code
+func runScenarioCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, scenarioUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("scenario "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to config file")
+	dbPath := fs.String("db", "", "Path to SQLite database file (overrides config)")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, scenarioUsage) }
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	// Every file is validated before anything is written
+	scenarios := make([]*services.Scenario, 0, len(files))
+	invalid := false
+	for _, path := range files {
+		sc, err := services.LoadScenario(path)
+		if err != nil {
+			invalid = true
+			printScenarioError(path, err)
+			continue
+		}
+		fmt.Printf("%s: ok (%q, %d tags)\n", path, sc.Name, len(sc.Tags))
+		scenarios = append(scenarios, sc)
+	}
+	if invalid {
+		return 1
+	}
+
+	switch args[0] {
+	case "validate":
+		return 0
+	case "run":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown scenario command %q\n\n%s", args[0], scenarioUsage)
+		return 2
+	}
+
+	cfg, err := config.LoadConfigWithDefaults(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	if *dbPath != "" {
+		cfg.Database.Path = *dbPath
+	}
+	db, err := database.NewDB(cfg.Database.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	db.SetWriteBatchSize(cfg.Database.WriteBatchSize)
+	generator := services.NewGenerator(db)
+	generator.SetWorkers(cfg.Data.GenerationWorkers)
+	scenarioService := services.NewScenarioService(db)
+	defaults := generationDefaults(cfg)
+
+	// Ctrl-C stops the run like cancelling a job: completed tags and committed batches are kept
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for i, sc := range scenarios {
+		opts, err := scenarioService.Prepare(sc, defaults)
+		if err != nil {
+			printScenarioError(files[i], err)
+			return 1
+		}
+		fmt.Printf("Running scenario %q from %s\n", sc.Name, files[i])
+		started := time.Now()
+		result, err := generator.GenerateDummyData(ctx, opts, func(tag string, records int) {
+			fmt.Printf("  %s: %d records\n", tag, records)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", files[i], err)
+			return 1
+		}
+		fmt.Printf("Scenario %q done: %d records for %d tags in %s, seed %d\n",
+			sc.Name, result.Records, result.Tags, time.Since(started).Round(time.Millisecond), result.Seed)
+	}
+	return 0
+}
+
+// printScenarioError prints a scenario error, one line per invalid field
+func printScenarioError(path string, err error) {
+	var scErr *services.ScenarioError
+	if !errors.As(err, &scErr) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", path, services.ErrInvalidScenario)
+	for _, fe := range scErr.Errors {
+		if fe.Field == "" {
+			fmt.Fprintf(os.Stderr, "  %s\n", fe.Message)
+		} else {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", fe.Field, fe.Message)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 )
 
 // Config represents the application configuration
@@ -21,7 +22,8 @@ type ServerConfig struct {
 
 // DatabaseConfig represents database configuration
 type DatabaseConfig struct {
-	Path string `json:"path"`
+	Path           string `json:"path"`
+	WriteBatchSize int    `json:"write_batch_size,omitempty"` // Optional: rows per INSERT statement of the generator, loader and upload (default 1000)
 }
 
 // DataConfig represents data configuration
@@ -32,6 +34,9 @@ type DataConfig struct {
 	UseSequentialGeneration bool        `json:"use_sequential_generation"`
 	GenerationStartTime     string      `json:"generation_start_time"`
 	GenerationEndTime       string      `json:"generation_end_time"`
+	GenerationSeed          *int64      `json:"generation_seed,omitempty"`     // Optional: fixed seed for reproducible generation runs
+	GenerationTimeZone      string      `json:"generation_timezone,omitempty"` // Optional: IANA zone of the generation time range and seasonality (default UTC)
+	GenerationWorkers       int         `json:"generation_workers,omitempty"`  // Optional: tags synthesized concurrently (default: number of CPUs)
 }
 
 // ValueRange represents the range for random value generation
@@ -69,6 +74,9 @@ func LoadConfig(configPath string) (*Config, error) {
 	if config.Database.Path == "" {
 		config.Database.Path = "insightsim.db"
 	}
+	if config.Database.WriteBatchSize < 0 {
+		return nil, fmt.Errorf("invalid write_batch_size %d: must not be negative", config.Database.WriteBatchSize)
+	}
 	if config.Data.RawDataFolder == "" {
 		config.Data.RawDataFolder = "raw_data"
 	}
@@ -93,6 +101,14 @@ func LoadConfig(configPath string) (*Config, error) {
 	if config.Data.GenerationEndTime == "" {
 		config.Data.GenerationEndTime = "2026-01-31T23:59:59"
 	}
+	if config.Data.GenerationWorkers < 0 {
+		return nil, fmt.Errorf("invalid generation_workers %d: must not be negative", config.Data.GenerationWorkers)
+	}
+	if config.Data.GenerationTimeZone != "" {
+		if _, err := time.LoadLocation(config.Data.GenerationTimeZone); err != nil {
+			return nil, fmt.Errorf("invalid generation_timezone %q: %w", config.Data.GenerationTimeZone, err)
+		}
+	}
 
 	return &config, nil
 }
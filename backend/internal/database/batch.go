@@ -0,0 +1,219 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultWriteBatchSize is the number of rows per INSERT statement when none is configured
+const DefaultWriteBatchSize = 1000
+
+// MaxWriteBatchSize caps the rows of one statement: 4 parameters per row stays below
+// SQLite's limit of 32766 host parameters
+const MaxWriteBatchSize = 8000
+
+// SetWriteBatchSize sets the batch size of writers created without one (<= 0 restores the default)
+func (db *DB) SetWriteBatchSize(n int) {
+	db.writeBatchSize = n
+}
+
+// WriteStats reports the throughput of a BatchWriter
+type WriteStats struct {
+	Rows       int           // Rows submitted
+	Written    int           // Rows inserted or updated; lower-quality duplicates are skipped
+	Statements int           // INSERT statements executed
+	Elapsed    time.Duration // Time since the writer was created
+}
+
+// RowsPerSec returns the submitted rows per second
+func (s WriteStats) RowsPerSec() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Rows) / s.Elapsed.Seconds()
+}
+
+// String formats the stats for logs
+func (s WriteStats) String() string {
+	return fmt.Sprintf("%d rows (%d written) in %v, %.0f rows/s, %d statements",
+		s.Rows, s.Written, s.Elapsed.Round(time.Millisecond), s.RowsPerSec(), s.Statements)
+}
+
+// BatchWriter upserts samples into insight_raws with multi-row statements. Rows are
+// buffered and executed batch size at a time in an open transaction that Commit ends;
+// the next row begins a new one. A row whose (tag, timestamp) already exists replaces the
+// stored sample only if its quality is at least the stored quality, unless the writer
+// overwrites. A BatchWriter is not safe for concurrent use.
+type BatchWriter struct {
+	conn      *sql.DB
+	batchSize int
+	overwrite bool
+	full      *sql.Stmt // statement for a full batch, prepared on first use
+	tx        *sql.Tx
+	args      []interface{}
+	stats     WriteStats
+	written   int // rows written in the open transaction
+	start     time.Time
+}
+
+// NewBatchWriter creates a writer executing batchSize rows per statement (<= 0 uses the
+// configured size). With overwrite, existing samples are replaced regardless of quality.
+func (db *DB) NewBatchWriter(batchSize int, overwrite bool) *BatchWriter {
+	if batchSize <= 0 {
+		batchSize = db.writeBatchSize
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultWriteBatchSize
+	}
+	if batchSize > MaxWriteBatchSize {
+		batchSize = MaxWriteBatchSize
+	}
+	return &BatchWriter{
+		conn:      db.conn,
+		batchSize: batchSize,
+		overwrite: overwrite,
+		args:      make([]interface{}, 0, 4*batchSize),
+		start:     time.Now(),
+	}
+}
+
+// BatchSize returns the rows per statement
+func (w *BatchWriter) BatchSize() int {
+	return w.batchSize
+}
+
+// Write buffers one sample, executing the batch once it is full
+func (w *BatchWriter) Write(tag string, timestamp int64, value float64, quality int) error {
+	w.args = append(w.args, tag, timestamp, value, quality)
+	w.stats.Rows++
+	if len(w.args) >= 4*w.batchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Exec runs a statement in the writer's transaction after the buffered rows, so it
+// commits or rolls back with them (e.g. deleting a tag before reinserting it)
+func (w *BatchWriter) Exec(query string, args ...interface{}) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := w.begin(); err != nil {
+		return err
+	}
+	if _, err := w.tx.Exec(query, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Flush executes the buffered rows in the open transaction without committing it
+func (w *BatchWriter) Flush() error {
+	rows := len(w.args) / 4
+	if rows == 0 {
+		return nil
+	}
+	if err := w.begin(); err != nil {
+		return err
+	}
+	var res sql.Result
+	var err error
+	if rows == w.batchSize {
+		if w.full == nil {
+			if w.full, err = w.conn.Prepare(upsertQuery(w.batchSize, w.overwrite)); err != nil {
+				return fmt.Errorf("failed to prepare batch insert: %w", err)
+			}
+		}
+		res, err = w.tx.Stmt(w.full).Exec(w.args...)
+	} else {
+		res, err = w.tx.Exec(upsertQuery(rows, w.overwrite), w.args...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write batch of %d records: %w", rows, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to write batch of %d records: %w", rows, err)
+	}
+	w.written += int(n)
+	w.stats.Statements++
+	w.args = w.args[:0]
+	return nil
+}
+
+// Commit flushes the buffered rows and commits the open transaction
+func (w *BatchWriter) Commit() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if w.tx == nil {
+		return nil
+	}
+	err := w.tx.Commit()
+	w.tx = nil
+	if err != nil {
+		w.written = 0
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+	w.stats.Written += w.written
+	w.written = 0
+	return nil
+}
+
+// Rollback discards the buffered rows and the open transaction
+func (w *BatchWriter) Rollback() {
+	w.args = w.args[:0]
+	w.written = 0
+	if w.tx != nil {
+		w.tx.Rollback()
+		w.tx = nil
+	}
+}
+
+// Close rolls back anything not committed and releases the prepared statement
+func (w *BatchWriter) Close() {
+	w.Rollback()
+	if w.full != nil {
+		w.full.Close()
+		w.full = nil
+	}
+}
+
+// Written returns the rows inserted or updated by committed transactions
+func (w *BatchWriter) Written() int {
+	return w.stats.Written
+}
+
+// Stats returns the writer's throughput so far
+func (w *BatchWriter) Stats() WriteStats {
+	s := w.stats
+	s.Elapsed = time.Since(w.start)
+	return s
+}
+
+func (w *BatchWriter) begin() error {
+	if w.tx != nil {
+		return nil
+	}
+	tx, err := w.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	w.tx = tx
+	return nil
+}
+
+// upsertQuery returns the multi-row upsert of rows samples
+func upsertQuery(rows int, overwrite bool) string {
+	var b strings.Builder
+	b.Grow(80 + rows*10 + 160)
+	b.WriteString("INSERT INTO insight_raws (tag, timestamp, value, quality) VALUES ")
+	b.WriteString(strings.Repeat("(?,?,?,?),", rows-1))
+	b.WriteString("(?,?,?,?) ON CONFLICT(tag, timestamp) DO UPDATE SET value = excluded.value, quality = excluded.quality")
+	if !overwrite {
+		b.WriteString(" WHERE excluded.quality >= insight_raws.quality")
+	}
+	return b.String()
+}
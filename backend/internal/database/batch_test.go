@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// Run with: go test ./internal/database -run '^$' -bench BatchWriter -benchtime 200000x
+// Each benchmark op writes one row; rows/s is reported alongside ns/op.
+
+const benchTags = 50
+
+func openBenchDB(b *testing.B) *DB {
+	b.Helper()
+	db, err := NewDB(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return db
+}
+
+// writeRows writes n rows spread over benchTags tags at 1-minute steps, committing every 10,000
+func writeRows(b *testing.B, w *BatchWriter, n int, quality int) {
+	b.Helper()
+	for i := 0; i < n; i++ {
+		tag := fmt.Sprintf("TAG_%02d", i%benchTags)
+		ts := int64(i/benchTags) * 60000
+		if err := w.Write(tag, ts, float64(i), quality); err != nil {
+			b.Fatal(err)
+		}
+		if (i+1)%10000 == 0 {
+			if err := w.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := w.Commit(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func reportRowsPerSec(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "rows/s")
+}
+
+// BenchmarkBatchWriterInsert measures inserting new rows at several batch sizes
+func BenchmarkBatchWriterInsert(b *testing.B) {
+	for _, size := range []int{1, 100, DefaultWriteBatchSize, MaxWriteBatchSize} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			db := openBenchDB(b)
+			w := db.NewBatchWriter(size, false)
+			defer w.Close()
+			b.ResetTimer()
+			writeRows(b, w, b.N, 3)
+			b.StopTimer()
+			reportRowsPerSec(b)
+		})
+	}
+}
+
+// BenchmarkBatchWriterUpsert measures rewriting existing rows with the quality check
+func BenchmarkBatchWriterUpsert(b *testing.B) {
+	for _, quality := range []int{3, 1} {
+		name := "replace"
+		if quality < 3 {
+			name = "skip-lower-quality"
+		}
+		b.Run(name, func(b *testing.B) {
+			db := openBenchDB(b)
+			w := db.NewBatchWriter(0, false)
+			defer w.Close()
+			writeRows(b, w, b.N, 3)
+			b.ResetTimer()
+			writeRows(b, w, b.N, quality)
+			b.StopTimer()
+			reportRowsPerSec(b)
+		})
+	}
+}
+
+// BenchmarkRowByRow is the former write path (SELECT, then INSERT or UPDATE per row) for comparison
+func BenchmarkRowByRow(b *testing.B) {
+	db := openBenchDB(b)
+	b.ResetTimer()
+	tx, err := db.conn.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		tag := fmt.Sprintf("TAG_%02d", i%benchTags)
+		ts := int64(i/benchTags) * 60000
+		var quality int
+		err := tx.QueryRow("SELECT quality FROM insight_raws WHERE tag = ? AND timestamp = ?", tag, ts).Scan(&quality)
+		if err == nil {
+			_, err = tx.Exec("UPDATE insight_raws SET value = ?, quality = ? WHERE tag = ? AND timestamp = ?", float64(i), 3, tag, ts)
+		} else {
+			_, err = tx.Exec("INSERT INTO insight_raws (tag, timestamp, value, quality) VALUES (?, ?, ?, ?)", tag, ts, float64(i), 3)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		if (i+1)%10000 == 0 {
+			if err := tx.Commit(); err != nil {
+				b.Fatal(err)
+			}
+			if tx, err = db.conn.Begin(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+	reportRowsPerSec(b)
+}
@@ -3,18 +3,25 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // DB wraps the database connection
 type DB struct {
-	conn *sql.DB
+	conn           *sql.DB
+	writeBatchSize int // rows per statement of batch writers (0 = DefaultWriteBatchSize)
 }
 
 // NewDB creates a new database connection and runs migrations
 func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", dbPath)
+	// Concurrent readers (e.g. generation workers) wait for a writer's lock instead of failing
+	dsn := dbPath + "?_busy_timeout=5000"
+	if strings.Contains(dbPath, "?") {
+		dsn = dbPath + "&_busy_timeout=5000"
+	}
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -282,6 +289,342 @@ func (db *DB) ListTagNamesFromTagsTable() ([]string, error) {
 	return result, rows.Err()
 }
 
+// GetTagProfile returns the generation profile JSON stored for a tag ("" if none).
+// found is false when the tag does not exist in the tags table.
+func (db *DB) GetTagProfile(tag string) (profile string, found bool, err error) {
+	var p sql.NullString
+	err = db.conn.QueryRow("SELECT profile FROM tags WHERE tag = ?", tag).Scan(&p)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("get tag profile: %w", err)
+	}
+	return p.String, true, nil
+}
+
+// SetTagProfile stores the generation profile JSON for a tag (empty string clears it).
+// Returns false if the tag does not exist.
+func (db *DB) SetTagProfile(tag, profile, updatedAt string) (bool, error) {
+	var p interface{}
+	if profile != "" {
+		p = profile
+	}
+	res, err := db.conn.Exec("UPDATE tags SET profile = ?, updated_at = ? WHERE tag = ?", p, updatedAt, tag)
+	if err != nil {
+		return false, fmt.Errorf("set tag profile: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("set tag profile: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ListTagProfiles returns tag -> profile JSON for every tag that has a profile
+func (db *DB) ListTagProfiles() (map[string]string, error) {
+	rows, err := db.conn.Query("SELECT tag, profile FROM tags WHERE profile IS NOT NULL AND profile != ''")
+	if err != nil {
+		return nil, fmt.Errorf("list tag profiles: %w", err)
+	}
+	defer rows.Close()
+	result := make(map[string]string)
+	for rows.Next() {
+		var tag, profile string
+		if err := rows.Scan(&tag, &profile); err != nil {
+			return nil, fmt.Errorf("scan tag profile: %w", err)
+		}
+		result[tag] = profile
+	}
+	return result, rows.Err()
+}
+
+// AnomalyRow is a row from the anomalies table (an event injected during generation)
+type AnomalyRow struct {
+	ID        int64
+	Tag       string
+	Type      string
+	StartTs   int64
+	EndTs     int64
+	Magnitude *float64
+	Quality   *int
+}
+
+// InsertAnomalies stores injected events in one transaction
+func (db *DB) InsertAnomalies(rows []AnomalyRow, createdAt string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("insert anomalies: %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("INSERT INTO anomalies (tag, type, start_ts, end_ts, magnitude, quality, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("insert anomalies: %w", err)
+	}
+	defer stmt.Close()
+	for _, r := range rows {
+		if _, err := stmt.Exec(r.Tag, r.Type, r.StartTs, r.EndTs, r.Magnitude, r.Quality, createdAt); err != nil {
+			return fmt.Errorf("insert anomaly: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteAllAnomalies deletes all rows from the anomalies table
+func (db *DB) DeleteAllAnomalies() error {
+	_, err := db.conn.Exec("DELETE FROM anomalies")
+	if err != nil {
+		return fmt.Errorf("failed to delete all anomalies: %w", err)
+	}
+	return nil
+}
+
+// DeleteRecordsExcept deletes the records and anomalies of every tag not in tags
+func (db *DB) DeleteRecordsExcept(tags []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("delete records: %w", err)
+	}
+	defer tx.Rollback()
+	args := make([]interface{}, len(tags))
+	for i, t := range tags {
+		args[i] = t
+	}
+	for _, table := range []string{"insight_raws", "anomalies"} {
+		query := "DELETE FROM " + table
+		if len(tags) > 0 {
+			query += " WHERE tag NOT IN (" + placeholders(len(tags)) + ")"
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("delete records from %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTagAnomalies deletes the anomalies recorded for a specific tag
+func (db *DB) DeleteTagAnomalies(tag string) error {
+	_, err := db.conn.Exec("DELETE FROM anomalies WHERE tag = ?", tag)
+	if err != nil {
+		return fmt.Errorf("failed to delete anomalies for tag %s: %w", tag, err)
+	}
+	return nil
+}
+
+// ListAnomalies returns anomalies overlapping [startTs, endTs], optionally filtered by tags and types
+func (db *DB) ListAnomalies(tags, types []string, startTs, endTs int64) ([]AnomalyRow, error) {
+	query := "SELECT id, tag, type, start_ts, end_ts, magnitude, quality FROM anomalies WHERE end_ts >= ? AND start_ts <= ?"
+	args := []interface{}{startTs, endTs}
+	if len(tags) > 0 {
+		query += " AND tag IN (" + placeholders(len(tags)) + ")"
+		for _, t := range tags {
+			args = append(args, t)
+		}
+	}
+	if len(types) > 0 {
+		query += " AND type IN (" + placeholders(len(types)) + ")"
+		for _, t := range types {
+			args = append(args, t)
+		}
+	}
+	query += " ORDER BY tag, start_ts"
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list anomalies: %w", err)
+	}
+	defer rows.Close()
+	var result []AnomalyRow
+	for rows.Next() {
+		var r AnomalyRow
+		var magnitude sql.NullFloat64
+		var quality sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.Tag, &r.Type, &r.StartTs, &r.EndTs, &magnitude, &quality); err != nil {
+			return nil, fmt.Errorf("scan anomaly: %w", err)
+		}
+		if magnitude.Valid {
+			r.Magnitude = &magnitude.Float64
+		}
+		if quality.Valid {
+			q := int(quality.Int64)
+			r.Quality = &q
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// CalculatedTagRow is a row from the calculated_tags table
+type CalculatedTagRow struct {
+	Tag        string
+	Expression string
+	CreatedAt  string
+	UpdatedAt  string
+}
+
+// InsertCalculatedTag registers a calculated tag: the definition plus a tags row with source "calculated".
+// Returns false if a tag with that name already exists.
+func (db *DB) InsertCalculatedTag(tag, expression, createdAt string) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("insert calculated tag: %w", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO tags (tag, created_at, updated_at, source) VALUES (?, ?, ?, 'calculated') ON CONFLICT(tag) DO NOTHING", tag, createdAt, createdAt)
+	if err != nil {
+		return false, fmt.Errorf("insert tag: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec("INSERT INTO calculated_tags (tag, expression, created_at, updated_at) VALUES (?, ?, ?, ?)", tag, expression, createdAt, createdAt); err != nil {
+		return false, fmt.Errorf("insert calculated tag: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// UpdateCalculatedTag replaces the expression of a calculated tag. Returns false if it does not exist.
+func (db *DB) UpdateCalculatedTag(tag, expression, updatedAt string) (bool, error) {
+	res, err := db.conn.Exec("UPDATE calculated_tags SET expression = ?, updated_at = ? WHERE tag = ?", expression, updatedAt, tag)
+	if err != nil {
+		return false, fmt.Errorf("update calculated tag: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("update calculated tag: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteCalculatedTag removes a calculated tag definition
+func (db *DB) DeleteCalculatedTag(tag string) error {
+	_, err := db.conn.Exec("DELETE FROM calculated_tags WHERE tag = ?", tag)
+	if err != nil {
+		return fmt.Errorf("delete calculated tag: %w", err)
+	}
+	return nil
+}
+
+// ListCalculatedTags returns all calculated tag definitions ordered by tag
+func (db *DB) ListCalculatedTags() ([]CalculatedTagRow, error) {
+	rows, err := db.conn.Query("SELECT tag, expression, created_at, updated_at FROM calculated_tags ORDER BY tag")
+	if err != nil {
+		return nil, fmt.Errorf("list calculated tags: %w", err)
+	}
+	defer rows.Close()
+	var result []CalculatedTagRow
+	for rows.Next() {
+		var r CalculatedTagRow
+		if err := rows.Scan(&r.Tag, &r.Expression, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan calculated tag: %w", err)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// SeriesPoint is one stored sample of a tag
+type SeriesPoint struct {
+	Timestamp int64
+	Value     float64
+	Quality   int
+}
+
+// ReadSeries returns the samples of a tag within [startTs, endTs] ordered by timestamp
+func (db *DB) ReadSeries(tag string, startTs, endTs int64) ([]SeriesPoint, error) {
+	rows, err := db.conn.Query("SELECT timestamp, value, quality FROM insight_raws WHERE tag = ? AND timestamp >= ? AND timestamp <= ? ORDER BY timestamp", tag, startTs, endTs)
+	if err != nil {
+		return nil, fmt.Errorf("read series for tag %s: %w", tag, err)
+	}
+	defer rows.Close()
+	var result []SeriesPoint
+	for rows.Next() {
+		var p SeriesPoint
+		if err := rows.Scan(&p.Timestamp, &p.Value, &p.Quality); err != nil {
+			return nil, fmt.Errorf("scan series point: %w", err)
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// LastPointBefore returns the latest sample of a tag strictly before ts (nil if none)
+func (db *DB) LastPointBefore(tag string, ts int64) (*SeriesPoint, error) {
+	var p SeriesPoint
+	err := db.conn.QueryRow("SELECT timestamp, value, quality FROM insight_raws WHERE tag = ? AND timestamp < ? ORDER BY timestamp DESC LIMIT 1", tag, ts).
+		Scan(&p.Timestamp, &p.Value, &p.Quality)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("last point before for tag %s: %w", tag, err)
+	}
+	return &p, nil
+}
+
+// FirstPointAfter returns the earliest sample of a tag strictly after ts (nil if none)
+func (db *DB) FirstPointAfter(tag string, ts int64) (*SeriesPoint, error) {
+	var p SeriesPoint
+	err := db.conn.QueryRow("SELECT timestamp, value, quality FROM insight_raws WHERE tag = ? AND timestamp > ? ORDER BY timestamp LIMIT 1", tag, ts).
+		Scan(&p.Timestamp, &p.Value, &p.Quality)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("first point after for tag %s: %w", tag, err)
+	}
+	return &p, nil
+}
+
+// DeleteTagRecordsInRange deletes the records of a tag within [startTs, endTs]
+func (db *DB) DeleteTagRecordsInRange(tag string, startTs, endTs int64) error {
+	_, err := db.conn.Exec("DELETE FROM insight_raws WHERE tag = ? AND timestamp >= ? AND timestamp <= ?", tag, startTs, endTs)
+	if err != nil {
+		return fmt.Errorf("failed to delete records for tag %s: %w", tag, err)
+	}
+	return nil
+}
+
+// placeholders returns "?,?,...,?" with n placeholders for an IN clause
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?,", n-1) + "?"
+}
+
+// SetTagFit stores (or replaces) the statistical fit JSON of a tag
+func (db *DB) SetTagFit(tag, fit, createdAt string) error {
+	_, err := db.conn.Exec("INSERT OR REPLACE INTO tag_fits (tag, fit, created_at) VALUES (?, ?, ?)", tag, fit, createdAt)
+	if err != nil {
+		return fmt.Errorf("set tag fit: %w", err)
+	}
+	return nil
+}
+
+// GetTagFit returns the fit JSON of a tag; found is false if the tag has no fit
+func (db *DB) GetTagFit(tag string) (fit string, found bool, err error) {
+	err = db.conn.QueryRow("SELECT fit FROM tag_fits WHERE tag = ?", tag).Scan(&fit)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("get tag fit: %w", err)
+	}
+	return fit, true, nil
+}
+
+// DeleteTagFit removes the fit of a tag
+func (db *DB) DeleteTagFit(tag string) error {
+	_, err := db.conn.Exec("DELETE FROM tag_fits WHERE tag = ?", tag)
+	if err != nil {
+		return fmt.Errorf("delete tag fit: %w", err)
+	}
+	return nil
+}
+
 // migrate creates the necessary tables if they don't exist
 func (db *DB) migrate() error {
 	query := `
@@ -302,6 +645,32 @@ func (db *DB) migrate() error {
 		updated_at TEXT NOT NULL,
 		source TEXT NOT NULL DEFAULT 'custom'
 	);
+
+	CREATE TABLE IF NOT EXISTS anomalies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tag TEXT NOT NULL,
+		type TEXT NOT NULL,
+		start_ts INTEGER NOT NULL,
+		end_ts INTEGER NOT NULL,
+		magnitude REAL,
+		quality INTEGER,
+		created_at TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_anomalies_tag_start ON anomalies(tag, start_ts);
+
+	CREATE TABLE IF NOT EXISTS calculated_tags (
+		tag TEXT PRIMARY KEY,
+		expression TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS tag_fits (
+		tag TEXT PRIMARY KEY,
+		fit TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);
 	`
 
 	_, err := db.conn.Exec(query)
@@ -309,5 +678,39 @@ func (db *DB) migrate() error {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
 
+	// Columns added after the initial schema
+	if err := db.addColumnIfMissing("tags", "profile", "TEXT"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table (SQLite has no ADD COLUMN IF NOT EXISTS)
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return fmt.Errorf("failed to scan column of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
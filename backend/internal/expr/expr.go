@@ -0,0 +1,455 @@
+// Package expr implements the small expression language used by calculated tags:
+// numbers, tag names, + - * / % ^, parentheses and math functions, e.g.
+//
+//	FI101 + FI102
+//	OUT / IN * 100
+//	max(0, sqrt([TI-200] - 273.15))
+//
+// Tag names are identifiers made of letters, digits, '_' and '.'; any other name can
+// be written in square brackets.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a parsed expression
+type Expr struct {
+	src  string
+	root node
+	vars []string
+}
+
+// Parse parses an expression
+func Parse(src string) (*Expr, error) {
+	p := &parser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tokens[p.pos].text, p.tokens[p.pos].pos+1)
+	}
+	seen := map[string]bool{}
+	var vars []string
+	collectVars(root, seen, &vars)
+	sort.Strings(vars)
+	return &Expr{src: src, root: root, vars: vars}, nil
+}
+
+// String returns the source text of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Vars returns the distinct tag names referenced by the expression, sorted
+func (e *Expr) Vars() []string {
+	return append([]string(nil), e.vars...)
+}
+
+// Eval evaluates the expression with the given tag values
+func (e *Expr) Eval(vars map[string]float64) (float64, error) {
+	return e.root.eval(vars)
+}
+
+// node is an expression tree node
+type node interface {
+	eval(vars map[string]float64) (float64, error)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(map[string]float64) (float64, error) {
+	return float64(n), nil
+}
+
+type varNode string
+
+func (n varNode) eval(vars map[string]float64) (float64, error) {
+	v, ok := vars[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("no value for %s", string(n))
+	}
+	return v, nil
+}
+
+type unaryNode struct {
+	x node
+}
+
+func (n unaryNode) eval(vars map[string]float64) (float64, error) {
+	x, err := n.x.eval(vars)
+	return -x, err
+}
+
+type binaryNode struct {
+	op   byte
+	l, r node
+}
+
+func (n binaryNode) eval(vars map[string]float64) (float64, error) {
+	l, err := n.l.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	r, err := n.r.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	case '/':
+		return l / r, nil
+	case '%':
+		return math.Mod(l, r), nil
+	default: // '^'
+		return math.Pow(l, r), nil
+	}
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n callNode) eval(vars map[string]float64) (float64, error) {
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = v
+	}
+	return n.fn.call(args), nil
+}
+
+// function is a built-in math function; maxArgs < 0 means variadic
+type function struct {
+	minArgs, maxArgs int
+	call             func(args []float64) float64
+}
+
+func unary(f func(float64) float64) function {
+	return function{1, 1, func(a []float64) float64 { return f(a[0]) }}
+}
+
+var functions = map[string]function{
+	"abs":   unary(math.Abs),
+	"sqrt":  unary(math.Sqrt),
+	"exp":   unary(math.Exp),
+	"ln":    unary(math.Log),
+	"log":   unary(math.Log),
+	"log10": unary(math.Log10),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"round": unary(math.Round),
+	"sin":   unary(math.Sin),
+	"cos":   unary(math.Cos),
+	"tan":   unary(math.Tan),
+	"pow":   {2, 2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min": {1, -1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	}},
+	"max": {1, -1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	}},
+	"avg": {1, -1, func(a []float64) float64 {
+		sum := 0.0
+		for _, v := range a {
+			sum += v
+		}
+		return sum / float64(len(a))
+	}},
+	"clamp": {3, 3, func(a []float64) float64 { return math.Max(a[1], math.Min(a[2], a[0])) }},
+}
+
+func collectVars(n node, seen map[string]bool, vars *[]string) {
+	switch n := n.(type) {
+	case varNode:
+		if !seen[string(n)] {
+			seen[string(n)] = true
+			*vars = append(*vars, string(n))
+		}
+	case unaryNode:
+		collectVars(n.x, seen, vars)
+	case binaryNode:
+		collectVars(n.l, seen, vars)
+		collectVars(n.r, seen, vars)
+	case callNode:
+		for _, a := range n.args {
+			collectVars(a, seen, vars)
+		}
+	}
+}
+
+// Tokens
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	num    float64
+	pos    int  // rune offset in the source
+	quoted bool // tag name written as [name]
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isIdentPart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+func (p *parser) tokenize() error {
+	src := []rune(p.src)
+	for i := 0; i < len(src); {
+		r := src[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(src) && unicode.IsDigit(src[i+1])):
+			start := i
+			for i < len(src) && (unicode.IsDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				j := i + 1
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				if j < len(src) && unicode.IsDigit(src[j]) {
+					for i = j; i < len(src) && unicode.IsDigit(src[i]); i++ {
+					}
+				}
+			}
+			text := string(src[start:i])
+			v, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q at position %d", text, start+1)
+			}
+			p.tokens = append(p.tokens, token{kind: tokNumber, text: text, num: v, pos: start})
+		case isIdentStart(r):
+			start := i
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: string(src[start:i]), pos: start})
+		case r == '[':
+			start := i
+			j := i + 1
+			for j < len(src) && src[j] != ']' {
+				j++
+			}
+			if j >= len(src) {
+				return fmt.Errorf("unterminated [ at position %d", start+1)
+			}
+			name := strings.TrimSpace(string(src[i+1 : j]))
+			if name == "" {
+				return fmt.Errorf("empty tag name at position %d", start+1)
+			}
+			i = j + 1
+			p.tokens = append(p.tokens, token{kind: tokIdent, text: name, pos: start, quoted: true})
+		case strings.ContainsRune("+-*/%^(),", r):
+			p.tokens = append(p.tokens, token{kind: tokOp, text: string(r), pos: i})
+			i++
+		default:
+			return fmt.Errorf("unexpected character %q at position %d", r, i+1)
+		}
+	}
+	return nil
+}
+
+func (p *parser) peekOp(ops string) (byte, bool) {
+	if p.pos >= len(p.tokens) {
+		return 0, false
+	}
+	t := p.tokens[p.pos]
+	if t.kind != tokOp || !strings.Contains(ops, t.text) {
+		return 0, false
+	}
+	return t.text[0], true
+}
+
+func (p *parser) expectOp(op string) error {
+	if _, ok := p.peekOp(op); !ok {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %q at end of expression", op)
+		}
+		return fmt.Errorf("expected %q at position %d", op, p.tokens[p.pos].pos+1)
+	}
+	p.pos++
+	return nil
+}
+
+// parseExpr: term (('+'|'-') term)*
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOp("+-")
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, l: left, r: right}
+	}
+}
+
+// parseTerm: unary (('*'|'/'|'%') unary)*
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOp("*/%")
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, l: left, r: right}
+	}
+}
+
+// parseUnary: ('-'|'+') unary | power
+func (p *parser) parseUnary() (node, error) {
+	if op, ok := p.peekOp("+-"); ok {
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == '-' {
+			return unaryNode{x: x}, nil
+		}
+		return x, nil
+	}
+	return p.parsePower()
+}
+
+// parsePower: primary ('^' unary)?  (right-associative)
+func (p *parser) parsePower() (node, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.peekOp("^"); ok {
+		p.pos++
+		exp, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return binaryNode{op: '^', l: base, r: exp}, nil
+	}
+	return base, nil
+}
+
+// parsePrimary: number | ident | ident '(' args ')' | '(' expr ')'
+func (p *parser) parsePrimary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	switch t.kind {
+	case tokNumber:
+		p.pos++
+		return numberNode(t.num), nil
+	case tokIdent:
+		p.pos++
+		if _, ok := p.peekOp("("); ok && !t.quoted {
+			return p.parseCall(t)
+		}
+		return varNode(t.text), nil
+	}
+	if t.text == "(" {
+		p.pos++
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos+1)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[strings.ToLower(name.text)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos+1)
+	}
+	p.pos++ // '('
+	var args []node
+	if _, ok := p.peekOp(")"); !ok {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.peekOp(","); !ok {
+				break
+			}
+			p.pos++
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("function %s: wrong number of arguments (%d)", name.text, len(args))
+	}
+	return callNode{name: strings.ToLower(name.text), fn: fn, args: args}, nil
+}
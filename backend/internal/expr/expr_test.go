@@ -0,0 +1,148 @@
+package expr
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]float64{"A": 6, "B": 2, "TI-200": 300, "x.y": 1.5}
+	for _, tc := range []struct {
+		src  string
+		want float64
+	}{
+		// Precedence and associativity
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"A / B * 3", 9},
+		{"7 % 4 + 1", 4},
+		{"2 ^ 3 ^ 2", 512},
+		{"2 * 3 ^ 2", 18},
+		// Unary minus binds looser than ^
+		{"-2 ^ 2", -4},
+		{"(-2) ^ 2", 4},
+		{"2 ^ -1", 0.5},
+		{"--A", 6},
+		{"+A - -B", 8},
+		{"A * -B", -12},
+		// Numbers and tag names
+		{"1.5e2 + .5", 150.5},
+		{"[TI-200] - 273.15", 300 - 273.15},
+		{"x.y * 2", 3},
+		// Functions (case-insensitive)
+		{"abs(-3)", 3},
+		{"sqrt(A + 10)", 4},
+		{"MAX(A, B, 7)", 7},
+		{"min(A, B)", 2},
+		{"avg(A, B, 1)", 3},
+		{"clamp(A, 0, 5)", 5},
+		{"pow(B, 10)", 1024},
+		{"round(2.5) + floor(-1.5) + ceil(1.2)", 3},
+		{"log10(1000)", 3},
+		{"max(0, sqrt([TI-200] - 284))", 4},
+	} {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.src, err)
+			continue
+		}
+		got, err := e.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tc.src, err)
+			continue
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("Eval(%q) = %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
+
+// TestEvalNonFinite checks that division by zero and invalid domains yield Inf or NaN
+// (callers skip non-finite results) rather than an error
+func TestEvalNonFinite(t *testing.T) {
+	vars := map[string]float64{"A": 1, "Z": 0}
+	for _, tc := range []struct {
+		src string
+		inf bool // +Inf, else NaN
+	}{
+		{"A / Z", true},
+		{"Z / Z", false},
+		{"A % Z", false},
+		{"sqrt(-A)", false},
+		{"ln(Z) * -1", true},
+	} {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.src, err)
+		}
+		got, err := e.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tc.src, err)
+			continue
+		}
+		if tc.inf && !math.IsInf(got, 1) || !tc.inf && !math.IsNaN(got) {
+			t.Errorf("Eval(%q) = %v", tc.src, got)
+		}
+	}
+}
+
+func TestEvalMissingVar(t *testing.T) {
+	e, err := Parse("A + B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Eval(map[string]float64{"A": 1}); err == nil || !strings.Contains(err.Error(), "no value for B") {
+		t.Errorf("Eval without B: err = %v", err)
+	}
+}
+
+func TestVars(t *testing.T) {
+	e, err := Parse("max(B, [TI-200]) + B * A - abs(A)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Vars(), []string{"A", "B", "TI-200"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Vars() = %v, want %v", got, want)
+	}
+	// A name written in brackets is a tag even when followed by '('
+	e, err = Parse("[max](2)")
+	if err == nil {
+		t.Errorf("Parse([max](2)) = %v, want an error", e.Vars())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"", "expression is empty"},
+		{"   ", "expression is empty"},
+		{"A +", "unexpected end of expression"},
+		{"(A + B", `expected ")" at end of expression`},
+		{"A + B)", `unexpected ")" at position 6`},
+		{"A B", `unexpected "B" at position 3`},
+		{"* A", `unexpected "*" at position 1`},
+		{"A $ B", `unexpected character '$' at position 3`},
+		{"1.2.3", `invalid number "1.2.3" at position 1`},
+		{"[TI-200", "unterminated [ at position 1"},
+		{"[ ] + 1", "empty tag name at position 1"},
+		{"foo(A)", `unknown function "foo" at position 1`},
+		{"sqrt(A, B)", "function sqrt: wrong number of arguments (2)"},
+		{"clamp(A)", "function clamp: wrong number of arguments (1)"},
+		{"max()", "function max: wrong number of arguments (0)"},
+		{"max(A,)", `unexpected ")" at position 7`},
+	} {
+		_, err := Parse(tc.src)
+		if err == nil {
+			t.Errorf("Parse(%q): no error, want %q", tc.src, tc.want)
+			continue
+		}
+		if err.Error() != tc.want {
+			t.Errorf("Parse(%q): %q, want %q", tc.src, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"insightsim/internal/services"
+)
+
+// AnomaliesHandler handles GET /api/anomalies requests
+type AnomaliesHandler struct {
+	anomalyService *services.AnomalyService
+}
+
+// NewAnomaliesHandler creates a new AnomaliesHandler instance
+func NewAnomaliesHandler(anomalyService *services.AnomalyService) *AnomaliesHandler {
+	return &AnomaliesHandler{anomalyService: anomalyService}
+}
+
+// AnomaliesResponse is the response for GET /api/anomalies
+type AnomaliesResponse struct {
+	Anomalies []services.Anomaly `json:"anomalies"`
+}
+
+// Handle lists injected anomalies (GET /api/anomalies?tags=a,b&type=spike,dropout&start=...&end=...)
+func (h *AnomaliesHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tags := splitList(q.Get("tags"))
+	types := splitList(q.Get("type"))
+
+	fmt.Printf("[API] GET /api/anomalies - tags: %d, types: %v, range: %s to %s\n", len(tags), types, q.Get("start"), q.Get("end"))
+
+	anomalies, err := h.anomalyService.ListAnomalies(tags, types, strings.TrimSpace(q.Get("start")), strings.TrimSpace(q.Get("end")))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AnomaliesResponse{Anomalies: anomalies})
+}
+
+// splitList splits a comma-separated query parameter, dropping empty items
+func splitList(param string) []string {
+	var items []string
+	for _, item := range strings.Split(param, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"insightsim/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// CalculatedTagsHandler handles GET/POST /api/calculated-tags and PUT/DELETE /api/calculated-tags/{tag}
+type CalculatedTagsHandler struct {
+	calculatedService *services.CalculatedTagService
+}
+
+// NewCalculatedTagsHandler creates a new CalculatedTagsHandler
+func NewCalculatedTagsHandler(calculatedService *services.CalculatedTagService) *CalculatedTagsHandler {
+	return &CalculatedTagsHandler{calculatedService: calculatedService}
+}
+
+// CalculatedTagRequest is the body for POST /api/calculated-tags and PUT /api/calculated-tags/{tag}
+type CalculatedTagRequest struct {
+	Tag        string `json:"tag"` // POST only
+	Expression string `json:"expression"`
+}
+
+// CalculatedTagsResponse is the response for GET /api/calculated-tags
+type CalculatedTagsResponse struct {
+	Items []services.CalculatedTag `json:"items"`
+}
+
+// HandleList returns all calculated tag definitions (GET /api/calculated-tags)
+func (h *CalculatedTagsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	items, err := h.calculatedService.List()
+	if err != nil {
+		writeCalculatedError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CalculatedTagsResponse{Items: items})
+}
+
+// HandlePost creates a calculated tag (POST /api/calculated-tags)
+func (h *CalculatedTagsHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
+	var req CalculatedTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON body"})
+		return
+	}
+	if err := h.calculatedService.Create(req.Tag, req.Expression); err != nil {
+		writeCalculatedError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandlePut replaces the expression of a calculated tag (PUT /api/calculated-tags/{tag})
+func (h *CalculatedTagsHandler) HandlePut(w http.ResponseWriter, r *http.Request) {
+	var req CalculatedTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON body"})
+		return
+	}
+	if err := h.calculatedService.Update(mux.Vars(r)["tag"], req.Expression); err != nil {
+		writeCalculatedError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleDelete removes a calculated tag and its materialized data (DELETE /api/calculated-tags/{tag})
+func (h *CalculatedTagsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.calculatedService.Delete(mux.Vars(r)["tag"]); err != nil {
+		writeCalculatedError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeCalculatedError maps calculated tag errors to 404 (unknown tag), 400 (invalid expression),
+// 409 (tag already exists) or 500
+func writeCalculatedError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrTagNotFound) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, services.ErrInvalidExpression) {
+		status = http.StatusBadRequest
+	} else if errors.Is(err, services.ErrCalculatedExists) {
+		status = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"insightsim/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// FitHandler handles /api/tags/{tag}/fit requests
+type FitHandler struct {
+	fitService *services.FitService
+}
+
+// NewFitHandler creates a new FitHandler instance
+func NewFitHandler(fitService *services.FitService) *FitHandler {
+	return &FitHandler{fitService: fitService}
+}
+
+// HandlePost fits the tag's stored history and saves the result (POST /api/tags/{tag}/fit).
+// The body is optional: {"start": "...", "end": "...", "timezone": "..."}.
+func (h *FitHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	var opts services.FitOptions
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			writeFitError(w, fmt.Errorf("%w: invalid JSON body", services.ErrInvalidFitOptions))
+			return
+		}
+	}
+	fmt.Printf("[API] POST /api/tags/%s/fit - start: %s, end: %s\n", tag, opts.Start, opts.End)
+	fit, err := h.fitService.Fit(tag, opts)
+	if err != nil {
+		writeFitError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fit)
+}
+
+// HandleGet returns the stored fit of a tag (GET /api/tags/{tag}/fit)
+func (h *FitHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	fit, err := h.fitService.Get(mux.Vars(r)["tag"])
+	if err != nil {
+		writeFitError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fit)
+}
+
+// HandleDelete removes the stored fit of a tag (DELETE /api/tags/{tag}/fit)
+func (h *FitHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	if err := h.fitService.Delete(mux.Vars(r)["tag"]); err != nil {
+		writeFitError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeFitError maps fit service errors to 404 (unknown tag or no fit), 400 or 500
+func writeFitError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrTagNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInsufficientData), errors.Is(err, services.ErrInvalidFitOptions):
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
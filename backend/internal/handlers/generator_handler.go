@@ -2,42 +2,40 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"strings"
 
+	"insightsim/internal/database"
 	"insightsim/internal/services"
 )
 
-// Stream event types for NDJSON response
-type streamEvent struct {
-	Event     string `json:"event"`
-	Tag       string `json:"tag,omitempty"`
-	Records   int    `json:"records,omitempty"`
-	Count     int    `json:"count,omitempty"`
-	TagsCount int    `json:"tags_count,omitempty"`
-	Message   string `json:"message,omitempty"`
-}
-
-// GeneratorHandler handles POST /api/generate-dummy requests
+// GeneratorHandler handles POST /api/generate-dummy and POST /api/jobs requests
 type GeneratorHandler struct {
-	generator     *services.Generator
+	jobs          *services.JobManager
 	minValue      float64
 	maxValue      float64
 	useSequential bool
 	startTime     string
 	endTime       string
+	seed          *int64
+	timeZone      string
 }
 
-// NewGeneratorHandler creates a new GeneratorHandler instance
-func NewGeneratorHandler(generator *services.Generator, minValue, maxValue float64, useSequential bool, startTime, endTime string) *GeneratorHandler {
+// NewGeneratorHandler creates a new GeneratorHandler instance. Runs are submitted to jobs;
+// seed is the configured default run seed (nil = random per run); timeZone is the default
+// zone of the time range.
+func NewGeneratorHandler(jobs *services.JobManager, minValue, maxValue float64, useSequential bool, startTime, endTime string, seed *int64, timeZone string) *GeneratorHandler {
 	return &GeneratorHandler{
-		generator:     generator,
+		jobs:          jobs,
 		minValue:      minValue,
 		maxValue:      maxValue,
 		useSequential: useSequential,
 		startTime:     startTime,
 		endTime:       endTime,
+		seed:          seed,
+		timeZone:      timeZone,
 	}
 }
 
@@ -46,9 +44,33 @@ type GenerateRequest struct {
 	Tag       string   `json:"tag,omitempty"`       // Optional: if provided, only generate for this tag
 	Start     string   `json:"start,omitempty"`     // Optional: start time (ISO 8601). If set, overrides config.
 	End       string   `json:"end,omitempty"`       // Optional: end time (ISO 8601). If set, overrides config.
-	Frequency string   `json:"frequency,omitempty"` // Optional: 1min, 5min, 15min, 30min, 1hour. Default 1min.
+	Frequency string   `json:"frequency,omitempty"` // Optional: step between records, e.g. 10s, 5m, 2m30s, 1d, PT4H or 1hour. Default 1m.
 	MinValue  *float64 `json:"minValue,omitempty"`  // Optional: override config value range min.
 	MaxValue  *float64 `json:"maxValue,omitempty"`  // Optional: override config value range max.
+	// Optional: signal model for all tags. Default random, or sequential when enabled in config.
+	Model *services.SignalSpec `json:"model,omitempty"`
+	// Optional: per-tag signal models (tag name -> model), overriding Model.
+	TagModels map[string]services.SignalSpec `json:"tag_models,omitempty"`
+	Seed      *int64                         `json:"seed,omitempty"` // Optional: run seed for reproducible values. Overrides config.
+	// Optional: events injected into the generated data (recorded in the anomalies table).
+	Anomalies []services.AnomalySpec `json:"anomalies,omitempty"`
+	// Optional: quality code model (weighted codes, bad-quality bursts, codes during faults). Default fixed 3.
+	Quality *services.QualitySpec `json:"quality,omitempty"`
+	// Optional: groups of tags generated jointly with a target correlation matrix.
+	Groups []services.CorrelationGroup `json:"groups,omitempty"`
+	// Optional: tags following a leader tag with a delay (tag = gain*leader(t-delay) + offset + noise).
+	Lags []services.LagRelation `json:"lags,omitempty"`
+	// Optional: calendar effects for all tags (daily profile, weekend/holiday multipliers, trend).
+	Seasonality *services.SeasonalitySpec `json:"seasonality,omitempty"`
+	TimeZone    string                    `json:"timezone,omitempty"` // Optional: IANA zone of start/end and seasonality. Overrides config.
+	// Optional: sample timing (sub-minute interval, offset, jitter, poisson) and exception/deadband recording.
+	Sampling *services.SamplingSpec `json:"sampling,omitempty"`
+	// Optional: write mode: replace (default), append, fill-gaps or extend-to-now.
+	Mode string `json:"mode,omitempty"`
+	// Optional: rows per INSERT statement (default from config, at most 8000).
+	BatchSize int `json:"batch_size,omitempty"`
+	// Optional: tags synthesized concurrently (default from config, or the number of CPUs).
+	Workers int `json:"workers,omitempty"`
 }
 
 // GenerateResponse represents the response from generate-dummy endpoint
@@ -59,23 +81,130 @@ type GenerateResponse struct {
 	TagsCount int    `json:"tags_count,omitempty"`
 }
 
-// Handle handles the generate-dummy request
+// Handle handles the generate-dummy request: the run is submitted as a job and its event
+// log is streamed as NDJSON until the job finishes. The job keeps running if the client
+// disconnects (see GET /api/jobs/{id}); its id is returned in the X-Job-Id header.
 func (h *GeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	opts, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+	job, err := h.jobs.SubmitGenerate(opts)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("X-Job-Id", job.ID)
+	streamJobEvents(w, r, h.jobs, job.ID)
+}
+
+// HandleSubmit submits a generation job and returns it without waiting (POST /api/jobs).
+// The body is the same as for POST /api/generate-dummy.
+func (h *GeneratorHandler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
+	opts, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+	job, err := h.jobs.SubmitGenerate(opts)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
 
+// parseRequest validates a GenerateRequest and resolves it against the configured defaults.
+// On failure it writes a 400 response and returns false.
+func (h *GeneratorHandler) parseRequest(w http.ResponseWriter, r *http.Request) (services.GenerateOptions, bool) {
 	// Parse request body (optional)
 	var req GenerateRequest
 	if r.Body != nil {
-		decoder := json.NewDecoder(r.Body)
-		decoder.Decode(&req) // Ignore errors, use empty struct if body is empty or invalid
+		// An empty body uses the defaults; malformed JSON is rejected
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return services.GenerateOptions{}, false
+		}
 	}
 
-	mode := "random"
+	model := services.SignalSpec{Type: services.SignalRandom}
 	if h.useSequential {
-		mode = "sequential (30% restriction)"
+		model.Type = services.SignalSequential
+	}
+	if req.Model != nil {
+		model = *req.Model
+	}
+	if err := model.Validate(); err != nil {
+		http.Error(w, "invalid model: "+err.Error(), http.StatusBadRequest)
+		return services.GenerateOptions{}, false
+	}
+	for tag, spec := range req.TagModels {
+		if err := spec.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid model for tag %s: %v", tag, err), http.StatusBadRequest)
+			return services.GenerateOptions{}, false
+		}
+	}
+	for i, spec := range req.Anomalies {
+		if err := spec.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("invalid anomalies[%d]: %v", i, err), http.StatusBadRequest)
+			return services.GenerateOptions{}, false
+		}
+	}
+	if req.Quality != nil {
+		if err := req.Quality.Validate(); err != nil {
+			http.Error(w, "invalid quality: "+err.Error(), http.StatusBadRequest)
+			return services.GenerateOptions{}, false
+		}
+	}
+	if err := services.ValidateRelations(req.Groups, req.Lags); err != nil {
+		http.Error(w, "invalid correlation: "+err.Error(), http.StatusBadRequest)
+		return services.GenerateOptions{}, false
+	}
+	if req.Seasonality != nil {
+		if err := req.Seasonality.Validate(); err != nil {
+			http.Error(w, "invalid seasonality: "+err.Error(), http.StatusBadRequest)
+			return services.GenerateOptions{}, false
+		}
+	}
+	if req.Sampling != nil {
+		if err := req.Sampling.Validate(); err != nil {
+			http.Error(w, "invalid sampling: "+err.Error(), http.StatusBadRequest)
+			return services.GenerateOptions{}, false
+		}
+	}
+	timeZone := h.timeZone
+	if req.TimeZone != "" {
+		timeZone = req.TimeZone
+	}
+	if _, err := services.LoadTimeZone(timeZone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return services.GenerateOptions{}, false
+	}
+	writeMode, err := services.ParseWriteMode(req.Mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return services.GenerateOptions{}, false
+	}
+	if writeMode == services.WriteFillGaps && len(req.Anomalies) > 0 {
+		http.Error(w, "anomalies are not supported with write mode "+writeMode, http.StatusBadRequest)
+		return services.GenerateOptions{}, false
+	}
+	if req.BatchSize < 0 || req.BatchSize > database.MaxWriteBatchSize {
+		http.Error(w, fmt.Sprintf("batch_size must be between 1 and %d", database.MaxWriteBatchSize), http.StatusBadRequest)
+		return services.GenerateOptions{}, false
+	}
+	if req.Workers < 0 {
+		http.Error(w, "workers must not be negative", http.StatusBadRequest)
+		return services.GenerateOptions{}, false
+	}
+	mode := model.Type
+	if len(req.TagModels) > 0 {
+		mode = fmt.Sprintf("%s (+%d per-tag)", mode, len(req.TagModels))
 	}
 
 	tagInfo := "all tags"
@@ -93,20 +222,10 @@ func (h *GeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		endTime = req.End
 	}
 
-	// Parse frequency: 1min, 5min, 15min, 30min, 1hour (case-insensitive). Default 1.
-	intervalMinutes := 1
-	switch strings.ToLower(strings.TrimSpace(req.Frequency)) {
-	case "5min":
-		intervalMinutes = 5
-	case "15min":
-		intervalMinutes = 15
-	case "30min":
-		intervalMinutes = 30
-	case "1hour":
-		intervalMinutes = 60
-	default:
-		// 1min or empty/invalid
-		intervalMinutes = 1
+	interval, err := services.ParseInterval(req.Frequency)
+	if err != nil {
+		http.Error(w, "invalid frequency: "+err.Error(), http.StatusBadRequest)
+		return services.GenerateOptions{}, false
 	}
 
 	// Use request min/max if provided; otherwise use config defaults
@@ -120,35 +239,35 @@ func (h *GeneratorHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 	if effectiveMin >= effectiveMax {
 		http.Error(w, "minValue must be less than maxValue", http.StatusBadRequest)
-		return
+		return services.GenerateOptions{}, false
 	}
 
-	fmt.Printf("[API] POST /api/generate-dummy - Starting generation for %s (value range: %.2f-%.2f, mode: %s, interval: %d min, time range: %s to %s)\n",
-		tagInfo, effectiveMin, effectiveMax, mode, intervalMinutes, startTime, endTime)
-
-	// Stream NDJSON: set headers and prepare flusher
-	w.Header().Set("Content-Type", "application/x-ndjson")
-	w.WriteHeader(http.StatusOK)
-	var flusher http.Flusher
-	if f, ok := w.(http.Flusher); ok {
-		flusher = f
-	}
-	writeEvent := func(ev streamEvent) {
-		data, _ := json.Marshal(ev)
-		w.Write(append(data, '\n'))
-		if flusher != nil {
-			flusher.Flush()
-		}
-	}
+	fmt.Printf("[API] POST %s - Starting generation for %s (value range: %.2f-%.2f, mode: %s, interval: %s, time range: %s to %s, write mode: %s)\n",
+		r.URL.Path, tagInfo, effectiveMin, effectiveMax, mode, interval, startTime, endTime, writeMode)
 
-	onTagComplete := func(tag string, records int) {
-		writeEvent(streamEvent{Event: "tag_complete", Tag: tag, Records: records})
+	opts := services.GenerateOptions{
+		MinValue:    effectiveMin,
+		MaxValue:    effectiveMax,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Tag:         req.Tag,
+		Interval:    interval,
+		Model:       model,
+		TagModels:   req.TagModels,
+		Seed:        h.seed,
+		Anomalies:   req.Anomalies,
+		Quality:     req.Quality,
+		Groups:      req.Groups,
+		Lags:        req.Lags,
+		Seasonality: req.Seasonality,
+		Sampling:    req.Sampling,
+		TimeZone:    timeZone,
+		Mode:        writeMode,
+		BatchSize:   req.BatchSize,
+		Workers:     req.Workers,
 	}
-
-	count, tagsCount, err := h.generator.GenerateDummyData(effectiveMin, effectiveMax, h.useSequential, startTime, endTime, req.Tag, intervalMinutes, onTagComplete)
-	if err != nil {
-		writeEvent(streamEvent{Event: "error", Message: err.Error()})
-		return
+	if req.Seed != nil {
+		opts.Seed = req.Seed
 	}
-	writeEvent(streamEvent{Event: "done", Count: count, TagsCount: tagsCount})
+	return opts, true
 }
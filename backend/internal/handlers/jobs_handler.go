@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"insightsim/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// JobsHandler handles GET /api/jobs and GET/DELETE /api/jobs/{id} (POST /api/jobs is GeneratorHandler.HandleSubmit)
+type JobsHandler struct {
+	jobs *services.JobManager
+}
+
+// NewJobsHandler creates a new JobsHandler
+func NewJobsHandler(jobs *services.JobManager) *JobsHandler {
+	return &JobsHandler{jobs: jobs}
+}
+
+// JobsResponse is the response for GET /api/jobs
+type JobsResponse struct {
+	Items []services.Job `json:"items"`
+}
+
+// HandleList returns the queued, running and recently finished jobs (GET /api/jobs)
+func (h *JobsHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(JobsResponse{Items: h.jobs.List()})
+}
+
+// HandleGet returns the status and progress of a job (GET /api/jobs/{id})
+func (h *JobsHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleDelete cancels a queued or running job (DELETE /api/jobs/{id})
+func (h *JobsHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	fmt.Printf("[API] DELETE /api/jobs/%s\n", id)
+	job, err := h.jobs.Cancel(id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleEvents streams the event log of a job as NDJSON until it finishes (GET /api/jobs/{id}/events)
+func (h *JobsHandler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := h.jobs.Get(id); err != nil {
+		writeJobError(w, err)
+		return
+	}
+	streamJobEvents(w, r, h.jobs, id)
+}
+
+// streamJobEvents writes the events of a job as NDJSON, from the first one, until the job
+// finishes or the client disconnects
+func streamJobEvents(w http.ResponseWriter, r *http.Request, jobs *services.JobManager, id string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	var flusher http.Flusher
+	if f, ok := w.(http.Flusher); ok {
+		flusher = f
+	}
+	next := 0
+	for {
+		events, changed, finished, err := jobs.Events(id, next)
+		if err != nil {
+			return
+		}
+		for _, ev := range events {
+			data, _ := json.Marshal(ev)
+			w.Write(append(data, '\n'))
+		}
+		if flusher != nil && len(events) > 0 {
+			flusher.Flush()
+		}
+		next += len(events)
+		if finished {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeJobError maps job errors to 404 (unknown job), 409 (already finished), 503 (queue full) or 500
+func writeJobError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrJobFinished):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrJobQueueFull):
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
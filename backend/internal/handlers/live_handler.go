@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"insightsim/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// LiveHandler handles GET/POST /api/live and GET/DELETE /api/live/{id}
+type LiveHandler struct {
+	liveService   *services.LiveService
+	minValue      float64
+	maxValue      float64
+	useSequential bool
+	seed          *int64
+	timeZone      string
+}
+
+// NewLiveHandler creates a new LiveHandler. The defaults match NewGeneratorHandler.
+func NewLiveHandler(liveService *services.LiveService, minValue, maxValue float64, useSequential bool, seed *int64, timeZone string) *LiveHandler {
+	return &LiveHandler{
+		liveService:   liveService,
+		minValue:      minValue,
+		maxValue:      maxValue,
+		useSequential: useSequential,
+		seed:          seed,
+		timeZone:      timeZone,
+	}
+}
+
+// LiveRequest is the body for POST /api/live
+type LiveRequest struct {
+	Tags      []string `json:"tags,omitempty"`      // Optional: tags to feed (default: all non-calculated tags)
+	Frequency string   `json:"frequency,omitempty"` // Optional: step between records, e.g. 10s, 5m, 1h, PT4H. Default 1m.
+	MinValue  *float64 `json:"minValue,omitempty"`  // Optional: override config value range min.
+	MaxValue  *float64 `json:"maxValue,omitempty"`  // Optional: override config value range max.
+	// Optional: signal model for all tags. Default random, or sequential when enabled in config.
+	Model *services.SignalSpec `json:"model,omitempty"`
+	// Optional: per-tag signal models (tag name -> model), overriding Model.
+	TagModels   map[string]services.SignalSpec `json:"tag_models,omitempty"`
+	Seed        *int64                         `json:"seed,omitempty"`
+	Quality     *services.QualitySpec          `json:"quality,omitempty"`
+	Seasonality *services.SeasonalitySpec      `json:"seasonality,omitempty"`
+	TimeZone    string                         `json:"timezone,omitempty"` // Optional: IANA zone of seasonality. Overrides config.
+}
+
+// LiveSessionsResponse is the response for GET /api/live
+type LiveSessionsResponse struct {
+	Items []services.LiveSession `json:"items"`
+}
+
+// HandleList returns the running live sessions (GET /api/live)
+func (h *LiveHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LiveSessionsResponse{Items: h.liveService.List()})
+}
+
+// HandlePost starts a live session (POST /api/live)
+func (h *LiveHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
+	var req LiveRequest
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeLiveError(w, fmt.Errorf("%w: invalid JSON body", services.ErrInvalidLiveOptions))
+			return
+		}
+	}
+	interval, err := services.ParseInterval(req.Frequency)
+	if err != nil {
+		writeLiveError(w, fmt.Errorf("%w: frequency: %v", services.ErrInvalidLiveOptions, err))
+		return
+	}
+	opts := services.LiveOptions{
+		Tags:        req.Tags,
+		MinValue:    h.minValue,
+		MaxValue:    h.maxValue,
+		Interval:    interval,
+		Model:       services.SignalSpec{Type: services.SignalRandom},
+		TagModels:   req.TagModels,
+		Seed:        h.seed,
+		Quality:     req.Quality,
+		Seasonality: req.Seasonality,
+		TimeZone:    h.timeZone,
+	}
+	if h.useSequential {
+		opts.Model.Type = services.SignalSequential
+	}
+	if req.Model != nil {
+		opts.Model = *req.Model
+	}
+	if req.MinValue != nil {
+		opts.MinValue = *req.MinValue
+	}
+	if req.MaxValue != nil {
+		opts.MaxValue = *req.MaxValue
+	}
+	if req.Seed != nil {
+		opts.Seed = req.Seed
+	}
+	if req.TimeZone != "" {
+		opts.TimeZone = req.TimeZone
+	}
+	fmt.Printf("[API] POST /api/live - tags: %v, interval: %s\n", req.Tags, opts.Interval)
+	session, err := h.liveService.Start(opts)
+	if err != nil {
+		writeLiveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// HandleGet returns one live session (GET /api/live/{id})
+func (h *LiveHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	session, err := h.liveService.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeLiveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// HandleDelete stops a live session and returns its final state (DELETE /api/live/{id})
+func (h *LiveHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	fmt.Printf("[API] DELETE /api/live/%s\n", id)
+	session, err := h.liveService.Stop(id)
+	if err != nil {
+		writeLiveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// writeLiveError maps live service errors to 404 (unknown session or tag), 409 (tag already live), 400 or 500
+func writeLiveError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrLiveNotFound), errors.Is(err, services.ErrTagNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrLiveConflict):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidLiveOptions):
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"insightsim/internal/services"
 )
@@ -64,11 +66,71 @@ func (h *QueryHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Parse aggregate query parameter (raw, daily, monthly, quarterly, yearly)
+	// Parse aggregate query parameter (raw, daily, weekly, monthly, quarterly, yearly)
 	aggregate := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("aggregate")))
-	allowedAggregate := map[string]bool{"raw": true, "daily": true, "monthly": true, "quarterly": true, "yearly": true}
-	if aggregate == "" || !allowedAggregate[aggregate] {
-		aggregate = "raw"
+	if aggregate == "" {
+		aggregate = services.BucketRaw
+	}
+	if !services.IsCalendarBucket(aggregate) {
+		writeQueryError(w, fmt.Errorf("%w: invalid aggregate %q (expected raw, daily, weekly, monthly, quarterly or yearly; use interval for fixed-length buckets)", services.ErrInvalidQuery, aggregate))
+		return
+	}
+
+	// Parse interval query parameter: fixed-length buckets (e.g. 15m, 2h, 1d, 1w, PT15M),
+	// aligned according to align (epoch (default), start, or an origin timestamp)
+	interval, err := durationParam(r, "interval")
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	align := r.URL.Query().Get("align")
+
+	// Parse tz query parameter: IANA zone of the calendar buckets (local midnight, DST) and
+	// of start/end without an offset; timestamps are then returned with their UTC offset
+	timeZone := strings.TrimSpace(r.URL.Query().Get("tz"))
+	if _, err := services.LoadTimeZone(timeZone); err != nil {
+		writeQueryError(w, fmt.Errorf("%w: %v", services.ErrInvalidQuery, err))
+		return
+	}
+
+	// Parse agg query parameter: statistics per bucket (sum (default), avg, min, max, count,
+	// first, last, stddev, median, range; several comma-separated), or a single delta or rate
+	// (counter tags), time_in_state, transitions or last_state (discrete tags), or twa or
+	// totalize (time-weighted). Resampling (method) has no value function: agg is only
+	// parsed when given, so that the service rejects the combination.
+	method := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("method")))
+	var aggs []string
+	if method == "" || r.URL.Query().Get("agg") != "" {
+		if aggs, err = services.ParseAggs(r.URL.Query().Get("agg")); err != nil {
+			writeQueryError(w, fmt.Errorf("%w: %v", services.ErrInvalidQuery, err))
+			return
+		}
+	}
+	agg := strings.Join(aggs, ",")
+
+	// Parse interp and per query parameters of twa/totalize: interpolation between samples
+	// (linear or step; default by tag) and the time unit of totalize (default 1s)
+	tw := services.TimeWeighting{Interp: strings.ToLower(strings.TrimSpace(r.URL.Query().Get("interp")))}
+	if tw.Per, err = durationParam(r, "per"); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	// Parse method, limit and extrapolate query parameters: resample mode, values of every
+	// tag at the interval grid points (previous, linear, nearest or none), the max distance
+	// to the samples used and how far values extend beyond a tag's first and last sample
+	resample := services.ResampleOptions{Method: method}
+	if resample.Limit, err = durationParam(r, "limit"); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	if resample.Extrapolate, err = durationParam(r, "extrapolate"); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	if method == "" && (resample.Limit > 0 || resample.Extrapolate > 0) {
+		writeQueryError(w, fmt.Errorf("%w: limit and extrapolate apply to resampling (method) only", services.ErrInvalidQuery))
+		return
 	}
 
 	// Log request
@@ -76,19 +138,51 @@ func (h *QueryHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	if len(tags) > 0 {
 		tagsInfo = fmt.Sprintf("%d tag(s)", len(tags))
 	}
-	fmt.Printf("[API] GET /api/timeseriesdata - Query: %s to %s, tags: %s, aggregate: %s\n", startTime, endTime, tagsInfo, aggregate)
+	fmt.Printf("[API] GET /api/timeseriesdata - Query: %s to %s, tags: %s, aggregate: %s, interval: %s, agg: %s, method: %s, tz: %s\n", startTime, endTime, tagsInfo, aggregate, interval, agg, method, timeZone)
 
 	// Query the data
-	result, err := h.queryService.QueryTimeseriesData(startTime, endTime, tags, aggregate)
+	result, err := h.queryService.QueryTimeseriesData(services.QueryOptions{
+		Start:     startTime,
+		End:       endTime,
+		Tags:      tags,
+		Aggregate: aggregate,
+		Interval:  interval,
+		Align:     align,
+		Aggs:      aggs,
+		TimeZone:  timeZone,
+
+		TimeWeighting: tw,
+		Resample:      resample,
+	})
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": err.Error(),
-		})
+		writeQueryError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
+
+// durationParam parses an optional duration query parameter (e.g. 15m, 2h, 1d, PT15M); 0 if absent
+func durationParam(r *http.Request, name string) (time.Duration, error) {
+	value := strings.TrimSpace(r.URL.Query().Get(name))
+	if value == "" {
+		return 0, nil
+	}
+	d, err := services.ParseInterval(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid %s: %v", services.ErrInvalidQuery, name, err)
+	}
+	return d, nil
+}
+
+// writeQueryError writes a JSON error response: 400 for invalid parameters, else 500
+func writeQueryError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrInvalidQuery) {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"insightsim/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ReplayHandler handles GET/POST /api/replay and GET/DELETE /api/replay/{id}
+type ReplayHandler struct {
+	replayService *services.ReplayService
+	timeZone      string
+}
+
+// NewReplayHandler creates a new ReplayHandler. timeZone is the default zone of the replay window.
+func NewReplayHandler(replayService *services.ReplayService, timeZone string) *ReplayHandler {
+	return &ReplayHandler{replayService: replayService, timeZone: timeZone}
+}
+
+// ReplaySessionsResponse is the response for GET /api/replay
+type ReplaySessionsResponse struct {
+	Items []services.ReplaySession `json:"items"`
+}
+
+// HandleList returns the replay sessions (GET /api/replay)
+func (h *ReplayHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReplaySessionsResponse{Items: h.replayService.List()})
+}
+
+// HandlePost starts a replay (POST /api/replay)
+func (h *ReplayHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
+	var opts services.ReplayOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeReplayError(w, fmt.Errorf("%w: invalid JSON body", services.ErrInvalidReplayOptions))
+		return
+	}
+	if opts.TimeZone == "" {
+		opts.TimeZone = h.timeZone
+	}
+	fmt.Printf("[API] POST /api/replay - tags: %v, window: %s to %s, speed: %g, loop: %v\n", opts.Tags, opts.Start, opts.End, opts.Speed, opts.Loop)
+	session, err := h.replayService.Start(opts)
+	if err != nil {
+		writeReplayError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// HandleGet returns the status of a replay (GET /api/replay/{id})
+func (h *ReplayHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	session, err := h.replayService.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeReplayError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// HandleDelete cancels a replay and returns its final state (DELETE /api/replay/{id})
+func (h *ReplayHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	fmt.Printf("[API] DELETE /api/replay/%s\n", id)
+	session, err := h.replayService.Cancel(id)
+	if err != nil {
+		writeReplayError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// writeReplayError maps replay service errors to 404 (unknown session or tag), 409 (tag already replayed), 400 or 500
+func writeReplayError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrReplayNotFound), errors.Is(err, services.ErrTagNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrReplayConflict):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidReplayOptions):
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -2,14 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"insightsim/internal/services"
+
+	"github.com/gorilla/mux"
 )
 
 // TagsHandler handles GET /api/tags, GET /api/tags/names, DELETE /api/tags?tag=..., POST /api/tags
+// and GET/PUT/DELETE /api/tags/{tag}/profile
 type TagsHandler struct {
 	tagsService *services.TagsService
 }
@@ -122,3 +126,62 @@ func (h *TagsHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(http.StatusCreated)
 }
+
+// TagProfileResponse is the response for GET /api/tags/{tag}/profile
+type TagProfileResponse struct {
+	Tag     string               `json:"tag"`
+	Profile *services.TagProfile `json:"profile"`
+}
+
+// HandleGetProfile returns a tag's generation profile (GET /api/tags/{tag}/profile)
+func (h *TagsHandler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	profile, err := h.tagsService.GetProfile(tag)
+	if err != nil {
+		writeTagError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TagProfileResponse{Tag: tag, Profile: profile})
+}
+
+// HandlePutProfile creates or replaces a tag's generation profile (PUT /api/tags/{tag}/profile)
+func (h *TagsHandler) HandlePutProfile(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	var profile services.TagProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON body"})
+		return
+	}
+	if err := h.tagsService.SetProfile(tag, &profile); err != nil {
+		writeTagError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TagProfileResponse{Tag: tag, Profile: &profile})
+}
+
+// HandleDeleteProfile clears a tag's generation profile (DELETE /api/tags/{tag}/profile)
+func (h *TagsHandler) HandleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	if err := h.tagsService.DeleteProfile(tag); err != nil {
+		writeTagError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeTagError maps tag service errors to 404 (unknown tag), 400 (validation) or 500
+func writeTagError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrTagNotFound) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, services.ErrInvalidProfile) {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
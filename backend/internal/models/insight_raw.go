@@ -19,6 +19,12 @@ type DataPoint struct {
 	Timestamp string  `json:"timestamp"` // ISO 8601 format: "2025-01-01T23:59:12"
 	Value     float64 `json:"value"`
 	Quality   int     `json:"quality"`
+	// Seconds per state (by label when the tag defines state labels); only set by agg=time_in_state
+	States map[string]float64 `json:"states,omitempty"`
+	// Statistic -> value for the bucket; only set when agg lists several functions (value holds the first)
+	Values map[string]float64 `json:"values,omitempty"`
+	// Whether the value was derived from other samples (true) or measured at the timestamp; only set by resampling
+	Interpolated *bool `json:"interpolated,omitempty"`
 }
 
 // JSONOutput represents the output JSON structure for API responses
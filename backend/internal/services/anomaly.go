@@ -0,0 +1,345 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+// Anomaly types accepted in AnomalySpec.Type
+const (
+	AnomalySpike      = "spike"
+	AnomalyLevelShift = "level_shift"
+	AnomalyDrift      = "drift"
+	AnomalyFlatline   = "flatline"
+	AnomalyDropout    = "dropout"
+	AnomalyBadQuality = "bad_quality"
+)
+
+// defaultBadQuality is the quality code written during bad_quality events
+const defaultBadQuality = 0
+
+// AnomalySpec configures one kind of event injected into generated data. Events are
+// placed randomly at Rate per tag per day, and/or at the explicit Windows.
+type AnomalySpec struct {
+	Type      string          `json:"type"`                // spike, level_shift, drift, flatline, dropout, bad_quality
+	Tags      []string        `json:"tags,omitempty"`      // Optional: only inject into these tags (default all)
+	Rate      float64         `json:"rate,omitempty"`      // Expected random events per tag per day
+	Windows   []AnomalyWindow `json:"windows,omitempty"`   // Explicit event windows
+	Duration  string          `json:"duration,omitempty"`  // Length of random events as a Go duration (default 30m; spikes last one sample)
+	Magnitude *float64        `json:"magnitude,omitempty"` // spike/level_shift: offset, drift: change reached at event end. Default ±25% of the value range.
+	Quality   *int            `json:"quality,omitempty"`   // bad_quality: quality code written (default 0)
+}
+
+// AnomalyWindow is an explicit event time window (same formats as generation start/end).
+// Timestamps without an offset are local time in the run's time zone.
+type AnomalyWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Anomaly is an injected event as stored in the anomalies table (ground truth label)
+type Anomaly struct {
+	Tag       string   `json:"tag"`
+	Type      string   `json:"type"`
+	Start     string   `json:"start"`
+	End       string   `json:"end"`
+	Magnitude *float64 `json:"magnitude,omitempty"`
+	Quality   *int     `json:"quality,omitempty"`
+}
+
+func normalizeAnomalyType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	return strings.ReplaceAll(t, "-", "_")
+}
+
+// Validate checks the spec type, rate, duration and windows.
+func (s AnomalySpec) Validate() error {
+	switch normalizeAnomalyType(s.Type) {
+	case AnomalySpike, AnomalyLevelShift, AnomalyDrift, AnomalyFlatline, AnomalyDropout, AnomalyBadQuality:
+	default:
+		return fmt.Errorf("unknown anomaly type %q", s.Type)
+	}
+	if s.Rate < 0 {
+		return fmt.Errorf("rate must not be negative, got %v", s.Rate)
+	}
+	if s.Rate == 0 && len(s.Windows) == 0 {
+		return fmt.Errorf("%s: either rate or windows is required", s.Type)
+	}
+	if _, err := s.duration(); err != nil {
+		return err
+	}
+	for i, w := range s.Windows {
+		// The zone does not change whether a window parses
+		if _, _, err := w.bounds(time.UTC); err != nil {
+			return fmt.Errorf("windows[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (s AnomalySpec) duration() (time.Duration, error) {
+	if strings.TrimSpace(s.Duration) == "" {
+		return 30 * time.Minute, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(s.Duration))
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", s.Duration, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %s", s.Duration)
+	}
+	return d, nil
+}
+
+func (s AnomalySpec) appliesTo(tag string) bool {
+	if len(s.Tags) == 0 {
+		return true
+	}
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// bounds returns the window in Unix ms; timestamps without an offset are local time in loc
+func (w AnomalyWindow) bounds(loc *time.Location) (int64, int64, error) {
+	start, err := parseTimestampInLocation(w.Start, loc)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start: %w", err)
+	}
+	end, err := parseTimestampInLocation(w.End, loc)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid end: %w", err)
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("end must not be before start")
+	}
+	return start, end, nil
+}
+
+// anomalyEvent is one planned event on one tag (timestamps in ms, inclusive)
+type anomalyEvent struct {
+	kind      string
+	start     int64
+	end       int64
+	magnitude float64
+	quality   int
+
+	frozen    bool // flatline: held value captured
+	heldValue float64
+	stored    bool // spike: a written sample carries it
+}
+
+// anomalyInjector applies a tag's planned events to its generated samples
+type anomalyInjector struct {
+	events     []*anomalyEvent // sorted by start
+	first      int             // events before first have ended (samples arrive in time order)
+	faultCodes map[string]int  // anomaly type -> quality code written while active
+}
+
+// planAnomalies places the events of specs that apply to tag within [startMs, endMs].
+// step is the tag's sample interval, used as the length of random spikes; loc is the run's
+// time zone, in which the windows are given.
+func planAnomalies(specs []AnomalySpec, tag string, startMs, endMs int64, step time.Duration, minValue, maxValue float64, loc *time.Location, rng *rand.Rand) *anomalyInjector {
+	inj := &anomalyInjector{}
+	days := float64(endMs-startMs) / float64(24*time.Hour/time.Millisecond)
+	for _, spec := range specs {
+		if !spec.appliesTo(tag) {
+			continue
+		}
+		kind := normalizeAnomalyType(spec.Type)
+		duration, _ := spec.duration()
+		if kind == AnomalySpike {
+			duration = step
+		}
+		newEvent := func(start, end int64) *anomalyEvent {
+			ev := &anomalyEvent{kind: kind, start: start, end: end, quality: defaultBadQuality}
+			if spec.Magnitude != nil {
+				ev.magnitude = *spec.Magnitude
+			} else {
+				ev.magnitude = 0.25 * (maxValue - minValue)
+				if rng.Intn(2) == 0 {
+					ev.magnitude = -ev.magnitude
+				}
+			}
+			if spec.Quality != nil {
+				ev.quality = *spec.Quality
+			}
+			return ev
+		}
+		for _, w := range spec.Windows {
+			s, e, _ := w.bounds(loc)
+			if e < startMs || s > endMs {
+				continue
+			}
+			inj.events = append(inj.events, newEvent(s, e))
+		}
+		if spec.Rate > 0 {
+			n := poisson(rng, spec.Rate*days)
+			for i := 0; i < n; i++ {
+				s := startMs + rng.Int63n(endMs-startMs+1)
+				inj.events = append(inj.events, newEvent(s, s+duration.Milliseconds()-1))
+			}
+		}
+	}
+	sort.Slice(inj.events, func(i, j int) bool { return inj.events[i].start < inj.events[j].start })
+	return inj
+}
+
+// poisson draws a Poisson-distributed count with the given mean (Knuth; normal approx for large means)
+func poisson(rng *rand.Rand, mean float64) int {
+	if mean <= 0 {
+		return 0
+	}
+	if mean > 500 {
+		n := int(mean + rng.NormFloat64()*math.Sqrt(mean) + 0.5)
+		if n < 0 {
+			return 0
+		}
+		return n
+	}
+	l := math.Exp(-mean)
+	k := 0
+	p := 1.0
+	for {
+		p *= rng.Float64()
+		if p <= l {
+			return k
+		}
+		k++
+	}
+}
+
+// apply returns the sample after active events: the (possibly modified) value and
+// quality, and keep=false when the sample is dropped.
+func (inj *anomalyInjector) apply(ts int64, value float64, quality int) (float64, int, bool) {
+	if inj == nil {
+		return value, quality, true
+	}
+	for inj.first < len(inj.events) && inj.events[inj.first].end < ts {
+		inj.first++
+	}
+	for _, ev := range inj.events[inj.first:] {
+		if ev.start > ts {
+			break
+		}
+		if ts > ev.end {
+			continue
+		}
+		if code, ok := inj.faultCodes[ev.kind]; ok {
+			quality = code
+		}
+		switch ev.kind {
+		case AnomalySpike, AnomalyLevelShift:
+			value += ev.magnitude
+		case AnomalyDrift:
+			frac := 1.0
+			if ev.end > ev.start {
+				frac = float64(ts-ev.start) / float64(ev.end-ev.start)
+			}
+			value += ev.magnitude * frac
+		case AnomalyFlatline:
+			if !ev.frozen {
+				ev.frozen = true
+				ev.heldValue = value
+			}
+			value = ev.heldValue
+		case AnomalyDropout:
+			return value, quality, false
+		case AnomalyBadQuality:
+			quality = ev.quality
+		}
+	}
+	return value, quality, true
+}
+
+// stored marks the spikes active at ts as written: the sample passed apply and was kept
+func (inj *anomalyInjector) stored(ts int64) {
+	if inj == nil {
+		return
+	}
+	for _, ev := range inj.events[inj.first:] {
+		if ev.start > ts {
+			break
+		}
+		if ev.kind == AnomalySpike && ts <= ev.end {
+			ev.stored = true
+		}
+	}
+}
+
+// rows converts the planned events to anomalies table rows. A spike that no written sample
+// carries (none fell on it, or it was dropped) is not a label.
+func (inj *anomalyInjector) rows(tag string) []database.AnomalyRow {
+	rows := make([]database.AnomalyRow, 0, len(inj.events))
+	for _, ev := range inj.events {
+		if ev.kind == AnomalySpike && !ev.stored {
+			continue
+		}
+		row := database.AnomalyRow{Tag: tag, Type: ev.kind, StartTs: ev.start, EndTs: ev.end}
+		switch ev.kind {
+		case AnomalySpike, AnomalyLevelShift, AnomalyDrift:
+			m := ev.magnitude
+			row.Magnitude = &m
+		case AnomalyBadQuality:
+			q := ev.quality
+			row.Quality = &q
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// AnomalyService lists injected anomalies (ground truth labels)
+type AnomalyService struct {
+	db *database.DB
+}
+
+// NewAnomalyService creates a new AnomalyService
+func NewAnomalyService(db *database.DB) *AnomalyService {
+	return &AnomalyService{db: db}
+}
+
+// ListAnomalies returns anomalies overlapping [startTime, endTime] (both optional) for the
+// given tags and types (empty = all).
+func (s *AnomalyService) ListAnomalies(tags, types []string, startTime, endTime string) ([]Anomaly, error) {
+	var startTs, endTs int64 = 0, 1<<63 - 1
+	var err error
+	if startTime != "" {
+		if startTs, err = parseTimestampToMillis(startTime); err != nil {
+			return nil, fmt.Errorf("invalid start time: %w", err)
+		}
+	}
+	if endTime != "" {
+		if endTs, err = parseTimestampToMillis(endTime); err != nil {
+			return nil, fmt.Errorf("invalid end time: %w", err)
+		}
+	}
+	for i, t := range types {
+		types[i] = normalizeAnomalyType(t)
+	}
+	rows, err := s.db.ListAnomalies(tags, types, startTs, endTs)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Anomaly, 0, len(rows))
+	for _, r := range rows {
+		result = append(result, Anomaly{
+			Tag:       r.Tag,
+			Type:      r.Type,
+			Start:     formatTimestamp(r.StartTs),
+			End:       formatTimestamp(r.EndTs),
+			Magnitude: r.Magnitude,
+			Quality:   r.Quality,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar buckets selected with the aggregate query parameter
+const (
+	BucketRaw       = "raw"
+	BucketDaily     = "daily"
+	BucketWeekly    = "weekly" // ISO weeks, starting on Monday
+	BucketMonthly   = "monthly"
+	BucketQuarterly = "quarterly"
+	BucketYearly    = "yearly"
+)
+
+// Bucket alignments of fixed-interval buckets (besides an origin timestamp)
+const (
+	AlignEpoch = "epoch" // Buckets start at multiples of the interval since 1970-01-01T00:00:00Z (default)
+	AlignStart = "start" // Buckets start at the start of the query range
+)
+
+// IsCalendarBucket reports whether aggregate names a calendar bucket (or raw)
+func IsCalendarBucket(aggregate string) bool {
+	switch aggregate {
+	case BucketRaw, BucketDaily, BucketWeekly, BucketMonthly, BucketQuarterly, BucketYearly:
+		return true
+	}
+	return false
+}
+
+// bucketing splits the time axis into aggregation buckets: calendar periods in a time zone
+// or fixed intervals starting at origin + k*step. The zero value means raw (no buckets).
+type bucketing struct {
+	calendar string         // daily, weekly, monthly, quarterly or yearly
+	step     int64          // Fixed bucket length in ms (when calendar is empty)
+	origin   int64          // Unix ms of one fixed bucket start
+	loc      *time.Location // Zone of the calendar periods (nil = UTC)
+	offset   string         // SQLite expression of the zone offset (ms) at timestamp ("" in UTC)
+}
+
+// newBucketing resolves the aggregate calendar bucket or the fixed interval (which takes
+// precedence) with its alignment; [startTs, endTs] is the query range. Calendar periods
+// start at local midnight in loc; an align timestamp without offset is local time in loc.
+func newBucketing(aggregate string, interval time.Duration, align string, startTs, endTs int64, loc *time.Location) (bucketing, error) {
+	align = strings.TrimSpace(align)
+	if interval <= 0 {
+		if align != "" {
+			return bucketing{}, fmt.Errorf("align applies to interval buckets only")
+		}
+		if aggregate == BucketRaw {
+			aggregate = ""
+		}
+		b := bucketing{calendar: aggregate, loc: loc}
+		if aggregate != "" && loc != nil && loc != time.UTC {
+			b.offset = zoneOffsetExpr(loc, startTs, endTs)
+		}
+		return b, nil
+	}
+	if aggregate != "" && aggregate != BucketRaw {
+		return bucketing{}, fmt.Errorf("use either aggregate=%s or interval, not both", aggregate)
+	}
+	b := bucketing{step: interval.Milliseconds(), loc: loc}
+	switch strings.ToLower(align) {
+	case "", AlignEpoch:
+	case AlignStart:
+		b.origin = startTs
+	default:
+		origin, err := parseTimestampInLocation(align, loc)
+		if err != nil {
+			return bucketing{}, fmt.Errorf("invalid align %q (expected epoch, start or an ISO 8601 origin timestamp)", align)
+		}
+		b.origin = origin
+	}
+	return b, nil
+}
+
+// raw reports whether there are no buckets
+func (b bucketing) raw() bool {
+	return b.calendar == "" && b.step <= 0
+}
+
+// String describes the bucketing for logs
+func (b bucketing) String() string {
+	switch {
+	case b.raw():
+		return BucketRaw
+	case b.calendar != "" && b.offset != "":
+		return fmt.Sprintf("%s (%s)", b.calendar, b.loc)
+	case b.calendar != "":
+		return b.calendar
+	case b.origin == 0:
+		return time.Duration(b.step * int64(time.Millisecond)).String()
+	default:
+		return fmt.Sprintf("%s from %s", time.Duration(b.step*int64(time.Millisecond)), formatTimestamp(b.origin))
+	}
+}
+
+// start returns the start of the bucket containing millis
+func (b bucketing) start(millis int64) time.Time {
+	if b.calendar == "" {
+		if b.step <= 0 {
+			return time.UnixMilli(millis).UTC()
+		}
+		return time.UnixMilli(millis - floorMod(millis-b.origin, b.step)).UTC()
+	}
+	loc := b.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	t := time.UnixMilli(millis).In(loc)
+	switch b.calendar {
+	case BucketDaily:
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	case BucketWeekly:
+		t = time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case BucketMonthly:
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	case BucketQuarterly:
+		t = time.Date(t.Year(), (t.Month()-1)/3*3+1, 1, 0, 0, 0, 0, loc)
+	case BucketYearly:
+		t = time.Date(t.Year(), 1, 1, 0, 0, 0, 0, loc)
+	}
+	return t
+}
+
+// end returns the (exclusive) end of the bucket starting at start. Calendar periods are
+// added in the bucket's zone, so a day is 23 or 25 hours long across a DST change.
+func (b bucketing) end(start time.Time) time.Time {
+	switch b.calendar {
+	case "":
+		return start.Add(time.Duration(b.step) * time.Millisecond)
+	case BucketWeekly:
+		return start.AddDate(0, 0, 7)
+	case BucketMonthly:
+		return start.AddDate(0, 1, 0)
+	case BucketQuarterly:
+		return start.AddDate(0, 3, 0)
+	case BucketYearly:
+		return start.AddDate(1, 0, 0)
+	default: // daily
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// sqlExpr returns a SQLite expression of the bucket start (Unix ms) of a row's timestamp.
+// Outside UTC the calendar period is computed on the local wall-clock time, and the
+// result is that period's wall-clock start: convert it with fromSQL.
+func (b bucketing) sqlExpr() string {
+	if b.calendar == "" {
+		// Floor modulo: SQLite's % keeps the sign of the dividend
+		return fmt.Sprintf("(timestamp - (((timestamp - %d) %% %d) + %d) %% %d)", b.origin, b.step, b.step, b.step)
+	}
+	// strftime with 'unixepoch' is UTC in SQLite: shift the timestamp to wall-clock time
+	ts := "timestamp"
+	if b.offset != "" {
+		ts = "(timestamp + " + b.offset + ")"
+	}
+	var modifiers string
+	switch b.calendar {
+	case BucketDaily:
+		modifiers = "'start of day'"
+	case BucketWeekly:
+		// Next Sunday (or the same day), then back to its Monday
+		modifiers = "'start of day', 'weekday 0', '-6 days'"
+	case BucketMonthly:
+		modifiers = "'start of month'"
+	case BucketQuarterly:
+		modifiers = "'start of month', '-' || ((CAST(strftime('%m', " + ts + "/1000, 'unixepoch') AS INTEGER) - 1) % 3) || ' months'"
+	case BucketYearly:
+		modifiers = "'start of year'"
+	}
+	return fmt.Sprintf("CAST(strftime('%%s', %s/1000, 'unixepoch', %s) AS INTEGER) * 1000", ts, modifiers)
+}
+
+// fromSQL converts a bucket start computed by sqlExpr to Unix ms
+func (b bucketing) fromSQL(bucket int64) int64 {
+	if b.offset == "" {
+		return bucket
+	}
+	wall := time.UnixMilli(bucket).UTC()
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), 0, 0, 0, 0, b.loc).UnixMilli()
+}
+
+// zoneOffsetExpr returns a SQLite expression of loc's UTC offset (ms) at timestamp, for
+// timestamps in [from, to]. SQLite has no time zone database, so the offset changes
+// within the range (found by scanning day by day) become a CASE on timestamp.
+func zoneOffsetExpr(loc *time.Location, from, to int64) string {
+	offsetAt := func(millis int64) int64 {
+		_, offset := time.UnixMilli(millis).In(loc).Zone()
+		return int64(offset) * 1000
+	}
+	const day = int64(24 * time.Hour / time.Millisecond)
+	var cases strings.Builder
+	offset := offsetAt(from)
+	for t := from; t < to; {
+		next := t + day
+		if next > to {
+			next = to
+		}
+		if offsetAt(next) == offset {
+			t = next
+			continue
+		}
+		// Binary search the first millisecond with the new offset
+		lo, hi := t, next
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if offsetAt(mid) == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		fmt.Fprintf(&cases, " WHEN timestamp < %d THEN %d", hi, offset)
+		offset, t = offsetAt(hi), hi
+	}
+	if cases.Len() == 0 {
+		return strconv.FormatInt(offset, 10)
+	}
+	return fmt.Sprintf("(CASE%s ELSE %d END)", cases.String(), offset)
+}
+
+// floorMod returns a mod m in [0, m)
+func floorMod(a, m int64) int64 {
+	r := a % m
+	if r < 0 {
+		r += m
+	}
+	return r
+}
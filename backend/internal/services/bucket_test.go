@@ -0,0 +1,238 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+// ms parses an RFC 3339 timestamp to Unix ms
+func ms(t *testing.T, s string) int64 {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts.UnixMilli()
+}
+
+func TestNewBucketing(t *testing.T) {
+	start, end := ms(t, "2026-01-01T00:07:00Z"), ms(t, "2026-01-02T00:00:00Z")
+	for _, tc := range []struct {
+		name      string
+		aggregate string
+		interval  time.Duration
+		align     string
+		want      string // String() of the bucketing; empty for an error
+	}{
+		{"raw", BucketRaw, 0, "", "raw"},
+		{"calendar", BucketMonthly, 0, "", "monthly"},
+		{"interval", "", 15 * time.Minute, "", "15m0s"},
+		{"interval with raw", BucketRaw, time.Hour, AlignEpoch, "1h0m0s"},
+		{"align start", "", time.Hour, AlignStart, "1h0m0s from 2026-01-01T00:07:00"},
+		{"align origin", "", time.Hour, "2026-01-01T00:30:00", "1h0m0s from 2026-01-01T00:30:00"},
+		{"align origin with offset", "", time.Hour, "2026-01-01T07:30:00+07:00", "1h0m0s from 2026-01-01T00:30:00"},
+		{"aggregate and interval", BucketDaily, time.Hour, "", ""},
+		{"align without interval", BucketDaily, 0, AlignStart, ""},
+		{"invalid align", "", time.Hour, "noon", ""},
+	} {
+		b, err := newBucketing(tc.aggregate, tc.interval, tc.align, start, end, time.UTC)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s: %v, want an error", tc.name, b)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBucketStart(t *testing.T) {
+	hour := int64(time.Hour / time.Millisecond)
+	for _, tc := range []struct {
+		name  string
+		b     bucketing
+		at    string
+		start string
+		end   string
+	}{
+		{"epoch hour", bucketing{step: hour}, "2026-01-01T10:59:59Z", "2026-01-01T10:00:00Z", "2026-01-01T11:00:00Z"},
+		{"15m from origin", bucketing{step: hour / 4, origin: ms(t, "2026-01-01T00:05:00Z")}, "2026-01-01T10:04:00Z",
+			"2026-01-01T09:50:00Z", "2026-01-01T10:05:00Z"},
+		{"origin after the sample", bucketing{step: hour, origin: ms(t, "2030-01-01T00:30:00Z")}, "2026-01-01T10:00:00Z",
+			"2026-01-01T09:30:00Z", "2026-01-01T10:30:00Z"},
+		{"daily", bucketing{calendar: BucketDaily}, "2026-03-15T23:59:59Z", "2026-03-15T00:00:00Z", "2026-03-16T00:00:00Z"},
+		// 2026-01-01 is a Thursday; ISO weeks start on Monday
+		{"weekly", bucketing{calendar: BucketWeekly}, "2026-01-01T12:00:00Z", "2025-12-29T00:00:00Z", "2026-01-05T00:00:00Z"},
+		{"weekly on Sunday", bucketing{calendar: BucketWeekly}, "2026-01-04T23:00:00Z", "2025-12-29T00:00:00Z", "2026-01-05T00:00:00Z"},
+		{"weekly on Monday", bucketing{calendar: BucketWeekly}, "2026-01-05T00:00:00Z", "2026-01-05T00:00:00Z", "2026-01-12T00:00:00Z"},
+		{"monthly", bucketing{calendar: BucketMonthly}, "2026-02-28T10:00:00Z", "2026-02-01T00:00:00Z", "2026-03-01T00:00:00Z"},
+		{"quarterly", bucketing{calendar: BucketQuarterly}, "2026-06-30T23:00:00Z", "2026-04-01T00:00:00Z", "2026-07-01T00:00:00Z"},
+		{"yearly", bucketing{calendar: BucketYearly}, "2026-12-31T23:59:59Z", "2026-01-01T00:00:00Z", "2027-01-01T00:00:00Z"},
+	} {
+		start := tc.b.start(ms(t, tc.at))
+		if got := start.UnixMilli(); got != ms(t, tc.start) {
+			t.Errorf("%s: start(%s) = %s, want %s", tc.name, tc.at, start.UTC().Format(time.RFC3339), tc.start)
+		}
+		if got := tc.b.end(start).UnixMilli(); got != ms(t, tc.end) {
+			t.Errorf("%s: end = %s, want %s", tc.name, tc.b.end(start).UTC().Format(time.RFC3339), tc.end)
+		}
+	}
+}
+
+// TestBucketSQLMatchesStart checks that the SQLite bucket expression computes the same
+// bucket starts as start, which the per-tag functions use
+func TestBucketSQLMatchesStart(t *testing.T) {
+	db := openTestDB(t)
+	hour := int64(time.Hour / time.Millisecond)
+	buckets := []bucketing{
+		{step: hour},
+		{step: 7 * hour, origin: ms(t, "2026-01-01T00:05:00Z")},
+		{step: hour, origin: ms(t, "2030-01-01T00:30:00Z")},
+		{calendar: BucketDaily},
+		{calendar: BucketWeekly},
+		{calendar: BucketMonthly},
+		{calendar: BucketQuarterly},
+		{calendar: BucketYearly},
+	}
+	checkBucketSQL(t, db, buckets, []string{
+		"1969-12-31T23:00:00Z", "2026-01-01T00:00:00Z", "2026-01-04T23:59:59Z", "2026-01-05T00:00:00Z",
+		"2026-02-28T12:34:56Z", "2026-05-31T23:59:59Z", "2026-11-15T08:00:00Z",
+	})
+}
+
+// checkBucketSQL compares sqlExpr (through fromSQL) with start at each timestamp
+func checkBucketSQL(t *testing.T, db *database.DB, buckets []bucketing, at []string) {
+	t.Helper()
+	for _, b := range buckets {
+		for _, s := range at {
+			ts := ms(t, s)
+			var got int64
+			if err := db.GetConn().QueryRow("SELECT "+b.sqlExpr()+" FROM (SELECT ? AS timestamp)", ts).Scan(&got); err != nil {
+				t.Fatalf("%s: %v", b, err)
+			}
+			if want := b.start(ts).UnixMilli(); b.fromSQL(got) != want {
+				t.Errorf("%s at %s: SQL bucket %s, want %s", b, s, time.UnixMilli(b.fromSQL(got)).UTC().Format(time.RFC3339),
+					time.UnixMilli(want).UTC().Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// TestBucketStartInTimeZone checks that calendar periods start at local midnight and
+// last 23 or 25 hours across a DST change
+func TestBucketStartInTimeZone(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hcm, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name  string
+		b     bucketing
+		at    string
+		start string
+		end   string
+	}{
+		{"daily", bucketing{calendar: BucketDaily, loc: hcm}, "2026-01-01T16:59:59Z", "2025-12-31T17:00:00Z", "2026-01-01T17:00:00Z"},
+		{"daily after local midnight", bucketing{calendar: BucketDaily, loc: hcm}, "2026-01-01T17:00:00Z", "2026-01-01T17:00:00Z", "2026-01-02T17:00:00Z"},
+		{"DST start", bucketing{calendar: BucketDaily, loc: ny}, "2026-03-08T12:00:00Z", "2026-03-08T05:00:00Z", "2026-03-09T04:00:00Z"},
+		{"DST end", bucketing{calendar: BucketDaily, loc: ny}, "2026-11-01T12:00:00Z", "2026-11-01T04:00:00Z", "2026-11-02T05:00:00Z"},
+		{"weekly", bucketing{calendar: BucketWeekly, loc: hcm}, "2026-01-04T17:30:00Z", "2026-01-04T17:00:00Z", "2026-01-11T17:00:00Z"},
+		{"monthly", bucketing{calendar: BucketMonthly, loc: ny}, "2026-03-01T03:00:00Z", "2026-02-01T05:00:00Z", "2026-03-01T05:00:00Z"},
+	} {
+		start := tc.b.start(ms(t, tc.at))
+		if got := start.UnixMilli(); got != ms(t, tc.start) {
+			t.Errorf("%s: start(%s) = %s, want %s", tc.name, tc.at, start.UTC().Format(time.RFC3339), tc.start)
+		}
+		if got := tc.b.end(start).UnixMilli(); got != ms(t, tc.end) {
+			t.Errorf("%s: end = %s, want %s", tc.name, tc.b.end(start).UTC().Format(time.RFC3339), tc.end)
+		}
+	}
+}
+
+// TestBucketSQLInTimeZone checks the SQLite bucket expression with the zone offsets of a
+// range spanning both DST changes of a year
+func TestBucketSQLInTimeZone(t *testing.T) {
+	db := openTestDB(t)
+	at := []string{
+		"2026-01-01T04:59:59Z", "2026-01-01T05:00:00Z", "2026-03-08T04:59:59Z", "2026-03-08T06:59:59Z",
+		"2026-03-08T07:00:00Z", "2026-03-09T03:59:59Z", "2026-03-09T04:00:00Z", "2026-04-01T03:59:59Z",
+		"2026-07-01T04:00:00Z", "2026-11-01T03:59:59Z", "2026-11-01T05:30:00Z", "2026-11-01T06:30:00Z",
+		"2026-11-02T04:59:59Z", "2026-11-02T05:00:00Z", "2026-12-31T23:00:00Z",
+	}
+	for _, zone := range []string{"America/New_York", "Asia/Ho_Chi_Minh", "Australia/Lord_Howe"} {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buckets []bucketing
+		for _, calendar := range []string{BucketDaily, BucketWeekly, BucketMonthly, BucketQuarterly, BucketYearly} {
+			b, err := newBucketing(calendar, 0, "", ms(t, "2026-01-01T00:00:00Z"), ms(t, "2027-01-01T00:00:00Z"), loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buckets = append(buckets, b)
+		}
+		checkBucketSQL(t, db, buckets, at)
+	}
+}
+
+func TestParseTimestampInLocation(t *testing.T) {
+	hcm, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		in   string
+		loc  *time.Location
+		want string
+	}{
+		{"2026-01-01T07:00:00", hcm, "2026-01-01T00:00:00Z"},
+		{"2026-01-01 07:00:00", hcm, "2026-01-01T00:00:00Z"},
+		{"2026-01-01T07:00:00", nil, "2026-01-01T07:00:00Z"},
+		{"2026-01-01T07:00:00Z", hcm, "2026-01-01T07:00:00Z"},
+		{"2026-01-01T07:00:00.000Z", hcm, "2026-01-01T07:00:00Z"},
+		{"2026-01-01T07:00:00+02:00", hcm, "2026-01-01T05:00:00Z"},
+	} {
+		got, err := parseTimestampInLocation(tc.in, tc.loc)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if got != ms(t, tc.want) {
+			t.Errorf("%q in %v = %s, want %s", tc.in, tc.loc, time.UnixMilli(got).UTC().Format(time.RFC3339), tc.want)
+		}
+	}
+	if _, err := parseTimestampInLocation("2026-01-01", hcm); err == nil {
+		t.Error("date without time: want an error")
+	}
+}
+
+// TestQueryTimeZone checks daily buckets at local midnight, with local start/end and
+// timestamps returned with their offset
+func TestQueryTimeZone(t *testing.T) {
+	db := openTestDB(t, "A")
+	// 23:00 on Jan 1 and 00:00 and 01:00 on Jan 2 in Ho Chi Minh City (UTC+7)
+	writeSeries(t, db, "A", t0+16*3600000, 1, 3, t0+17*3600000, 2, 3, t0+18*3600000, 4, 3)
+	out, err := NewQueryService(db).QueryTimeseriesData(QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-02T23:59:59",
+		Tags: []string{"A"}, Aggregate: BucketDaily, TimeZone: "Asia/Ho_Chi_Minh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := out.Result["A"]
+	if len(got) != 2 || got[0].Timestamp != "2026-01-01T00:00:00+07:00" || got[0].Value != 1 ||
+		got[1].Timestamp != "2026-01-02T00:00:00+07:00" || got[1].Value != 6 {
+		t.Errorf("daily = %+v, want 1 on Jan 1 and 6 on Jan 2 (local)", got)
+	}
+}
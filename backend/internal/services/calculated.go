@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"insightsim/internal/database"
+	"insightsim/internal/expr"
+)
+
+// ErrInvalidExpression wraps validation failures of a calculated tag expression
+var ErrInvalidExpression = errors.New("invalid expression")
+
+// ErrCalculatedExists is returned when creating a calculated tag whose name is already a tag
+var ErrCalculatedExists = errors.New("tag already exists")
+
+// CalculatedTag is the API view of a calculated tag definition
+type CalculatedTag struct {
+	Tag        string   `json:"tag"`
+	Expression string   `json:"expression"`
+	Inputs     []string `json:"inputs"`
+	CreatedAt  string   `json:"created_at"`
+	UpdatedAt  string   `json:"updated_at"`
+}
+
+// CalculatedTagService manages calculated (derived) tag definitions
+type CalculatedTagService struct {
+	db *database.DB
+}
+
+// NewCalculatedTagService creates a new CalculatedTagService
+func NewCalculatedTagService(db *database.DB) *CalculatedTagService {
+	return &CalculatedTagService{db: db}
+}
+
+// List returns all calculated tag definitions
+func (s *CalculatedTagService) List() ([]CalculatedTag, error) {
+	rows, err := s.db.ListCalculatedTags()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]CalculatedTag, 0, len(rows))
+	for _, r := range rows {
+		item := CalculatedTag{Tag: r.Tag, Expression: r.Expression, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt}
+		if e, err := expr.Parse(r.Expression); err == nil {
+			item.Inputs = e.Vars()
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// Create validates the expression and registers a calculated tag (also added to the tags table)
+func (s *CalculatedTagService) Create(tag, expression string) error {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return fmt.Errorf("%w: tag name is empty", ErrInvalidExpression)
+	}
+	if err := s.validate(tag, expression); err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	created, err := s.db.InsertCalculatedTag(tag, strings.TrimSpace(expression), now)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ErrCalculatedExists
+	}
+	return nil
+}
+
+// Update replaces the expression of an existing calculated tag
+func (s *CalculatedTagService) Update(tag, expression string) error {
+	if err := s.validate(tag, expression); err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	found, err := s.db.UpdateCalculatedTag(tag, strings.TrimSpace(expression), now)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrTagNotFound
+	}
+	return nil
+}
+
+// Delete removes a calculated tag: its definition, materialized records and tags row
+func (s *CalculatedTagService) Delete(tag string) error {
+	defs, err := loadCalculatedDefs(s.db)
+	if err != nil {
+		return err
+	}
+	if _, ok := defs[tag]; !ok {
+		return ErrTagNotFound
+	}
+	if err := s.db.DeleteCalculatedTag(tag); err != nil {
+		return err
+	}
+	if err := s.db.DeleteTagRecords(tag); err != nil {
+		return err
+	}
+	return s.db.DeleteTag(tag)
+}
+
+// validate parses the expression and checks that every input is an existing, non-calculated tag
+func (s *CalculatedTagService) validate(tag, expression string) error {
+	e, err := expr.Parse(strings.TrimSpace(expression))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExpression, err)
+	}
+	inputs := e.Vars()
+	if len(inputs) == 0 {
+		return fmt.Errorf("%w: expression must reference at least one tag", ErrInvalidExpression)
+	}
+	names, err := s.db.ListTagNamesFromTagsTable()
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(names))
+	for _, n := range names {
+		known[n] = true
+	}
+	defs, err := loadCalculatedDefs(s.db)
+	if err != nil {
+		return err
+	}
+	for _, in := range inputs {
+		switch {
+		case in == tag:
+			return fmt.Errorf("%w: %s cannot reference itself", ErrInvalidExpression, tag)
+		case !known[in]:
+			return fmt.Errorf("%w: unknown tag %s", ErrInvalidExpression, in)
+		case defs[in] != nil:
+			return fmt.Errorf("%w: %s is a calculated tag and cannot be used as an input", ErrInvalidExpression, in)
+		}
+	}
+	return nil
+}
+
+// loadCalculatedDefs returns tag -> parsed expression for every calculated tag
+func loadCalculatedDefs(db *database.DB) (map[string]*expr.Expr, error) {
+	rows, err := db.ListCalculatedTags()
+	if err != nil {
+		return nil, err
+	}
+	defs := make(map[string]*expr.Expr, len(rows))
+	for _, r := range rows {
+		e, err := expr.Parse(r.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("calculated tag %s: %w", r.Tag, err)
+		}
+		defs[r.Tag] = e
+	}
+	return defs, nil
+}
+
+// computeCalculated evaluates e over its inputs within [startTs, endTs]. Inputs are aligned on
+// the union of their timestamps, each holding its last value (including the last sample before
+// startTs); a point is produced once every input has a value. Quality is the worst input quality.
+// Non-finite results (e.g. division by zero) are skipped.
+func computeCalculated(db *database.DB, e *expr.Expr, startTs, endTs int64) ([]database.SeriesPoint, error) {
+	inputs := e.Vars()
+	series := make([][]database.SeriesPoint, len(inputs))
+	current := make([]*database.SeriesPoint, len(inputs))
+	var stamps []int64
+	seen := make(map[int64]bool)
+	for i, in := range inputs {
+		pts, err := db.ReadSeries(in, startTs, endTs)
+		if err != nil {
+			return nil, err
+		}
+		series[i] = pts
+		for _, p := range pts {
+			if !seen[p.Timestamp] {
+				seen[p.Timestamp] = true
+				stamps = append(stamps, p.Timestamp)
+			}
+		}
+		if current[i], err = db.LastPointBefore(in, startTs); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+
+	next := make([]int, len(inputs))
+	vars := make(map[string]float64, len(inputs))
+	result := make([]database.SeriesPoint, 0, len(stamps))
+	for _, ts := range stamps {
+		ready := true
+		quality := math.MaxInt32
+		for i := range inputs {
+			for next[i] < len(series[i]) && series[i][next[i]].Timestamp <= ts {
+				current[i] = &series[i][next[i]]
+				next[i]++
+			}
+			if current[i] == nil {
+				ready = false
+				break
+			}
+			vars[inputs[i]] = current[i].Value
+			if current[i].Quality < quality {
+				quality = current[i].Quality
+			}
+		}
+		if !ready {
+			continue
+		}
+		v, err := e.Eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		result = append(result, database.SeriesPoint{Timestamp: ts, Value: v, Quality: quality})
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"insightsim/internal/database"
+	"insightsim/internal/expr"
+)
+
+// t0 is 2026-01-01T00:00:00Z in millis
+const t0 = 1767225600000
+
+func TestComputeCalculated(t *testing.T) {
+	db := openTestDB(t, "A", "B", "Z")
+	writeSeries(t, db, "A", t0-60000, 10, 3, t0+60000, 20, 3, t0+180000, 40, 1)
+	writeSeries(t, db, "B", t0-120000, 1, 3, t0+240000, 5, 3)
+	writeSeries(t, db, "Z", t0+120000, 0, 3, t0+240000, 8, 3)
+
+	for _, tc := range []struct {
+		src  string
+		want []database.SeriesPoint
+	}{
+		// Inputs hold their last value, including the last sample before the range;
+		// quality is the worst input quality
+		{"A - B", []database.SeriesPoint{
+			{Timestamp: t0 + 60000, Value: 19, Quality: 3},
+			{Timestamp: t0 + 180000, Value: 39, Quality: 1},
+			{Timestamp: t0 + 240000, Value: 35, Quality: 1},
+		}},
+		// No point before every input has a value; division by zero is skipped
+		{"A / Z", []database.SeriesPoint{
+			{Timestamp: t0 + 240000, Value: 5, Quality: 1},
+		}},
+	} {
+		e, err := expr.Parse(tc.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := computeCalculated(db, e, t0, t0+300000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: %v, want %v", tc.src, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: point %d = %v, want %v", tc.src, i, got[i], tc.want[i])
+			}
+		}
+	}
+}
+
+func TestCalculatedTagCreate(t *testing.T) {
+	db := openTestDB(t, "A", "B")
+	s := NewCalculatedTagService(db)
+	if err := s.Create("DIFF", "A - B"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		tag, src string
+		want     error
+	}{
+		{"DIFF", "A + B", ErrCalculatedExists},
+		{"A", "B * 2", ErrCalculatedExists},
+		{"X", "A + UNKNOWN", ErrInvalidExpression},
+		{"X", "DIFF * 2", ErrInvalidExpression},
+		{"X", "X + A", ErrInvalidExpression},
+		{"X", "1 + 2", ErrInvalidExpression},
+		{"X", "A +", ErrInvalidExpression},
+		{" ", "A", ErrInvalidExpression},
+	} {
+		if err := s.Create(tc.tag, tc.src); !errors.Is(err, tc.want) {
+			t.Errorf("Create(%q, %q) = %v, want %v", tc.tag, tc.src, err, tc.want)
+		}
+	}
+	items, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Expression != "A - B" {
+		t.Errorf("List() = %+v, want only DIFF", items)
+	}
+}
+
+// TestQueryCalculatedTag checks that a requested calculated tag is computed on the fly,
+// raw and aggregated, alongside stored tags
+func TestQueryCalculatedTag(t *testing.T) {
+	db := openTestDB(t, "A", "B")
+	writeSeries(t, db, "A", t0, 10, 3, t0+60000, 20, 3)
+	writeSeries(t, db, "B", t0, 1, 3, t0+60000, 2, 2)
+	if err := NewCalculatedTagService(db).Create("SUM", "A + B"); err != nil {
+		t.Fatal(err)
+	}
+	q := NewQueryService(db)
+
+	out, err := q.QueryTimeseriesData(QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-01T00:05:00", Tags: []string{"SUM", "A"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(out.Result["A"]); n != 2 {
+		t.Errorf("A: %d points, want 2", n)
+	}
+	got := out.Result["SUM"]
+	if len(got) != 2 || got[0].Value != 11 || got[1].Value != 22 || got[1].Quality != 2 ||
+		got[1].Timestamp != "2026-01-01T00:01:00" {
+		t.Errorf("SUM raw = %+v, want 11 then 22 (quality 2) at 00:01:00", got)
+	}
+
+	out, err = q.QueryTimeseriesData(QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-01T23:59:59", Tags: []string{"SUM"},
+		Aggregate: "daily", Aggs: []string{"sum"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Result["SUM"]; len(got) != 1 || got[0].Value != 33 {
+		t.Errorf("SUM daily = %+v, want 33", got)
+	}
+}
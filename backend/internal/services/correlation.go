@@ -0,0 +1,281 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+// CorrelationGroup declares tags generated jointly so that their series follow a target
+// correlation matrix. Members are driven by a shared AR(1) process scaled to each tag's
+// value range (mean at the midpoint, ±3σ spanning the range) instead of their signal model.
+type CorrelationGroup struct {
+	Tags        []string    `json:"tags"`
+	Correlation [][]float64 `json:"correlation"`         // Symmetric, positive definite, 1 on the diagonal
+	Smoothing   float64     `json:"smoothing,omitempty"` // AR(1) coefficient in [0, 1): 0 = independent samples, 0.99 = slow moving
+}
+
+// LagRelation makes Tag follow Leader with a delay: tag(t) = gain*leader(t-delay) + offset + noise.
+// The leader's clean values (before injected anomalies) are used; a leader not generated in the
+// same run is read from the database.
+type LagRelation struct {
+	Tag    string   `json:"tag"`
+	Leader string   `json:"leader"`
+	Delay  string   `json:"delay,omitempty"`  // Go duration, e.g. "10m"
+	Gain   *float64 `json:"gain,omitempty"`   // Default 1
+	Offset float64  `json:"offset,omitempty"` // Added after the gain
+	Noise  float64  `json:"noise,omitempty"`  // Std dev of gaussian noise
+	// Replace mode: synthesize a leader not in the run in memory from the run seed even if it
+	// has stored records, so the follower matches a full run with the same seed
+	Resynthesize bool `json:"resynthesize,omitempty"`
+}
+
+// Validate checks the group size, matrix shape and that the matrix is a valid correlation matrix.
+func (g CorrelationGroup) Validate() error {
+	n := len(g.Tags)
+	if n < 2 {
+		return fmt.Errorf("a correlation group needs at least 2 tags")
+	}
+	seen := map[string]bool{}
+	for _, t := range g.Tags {
+		if seen[t] {
+			return fmt.Errorf("duplicate tag %s", t)
+		}
+		seen[t] = true
+	}
+	if len(g.Correlation) != n {
+		return fmt.Errorf("correlation must be a %dx%d matrix", n, n)
+	}
+	for i, row := range g.Correlation {
+		if len(row) != n {
+			return fmt.Errorf("correlation must be a %dx%d matrix", n, n)
+		}
+		if row[i] != 1 {
+			return fmt.Errorf("correlation[%d][%d] must be 1", i, i)
+		}
+		for j, v := range row {
+			if v < -1 || v > 1 {
+				return fmt.Errorf("correlation[%d][%d] must be between -1 and 1", i, j)
+			}
+			if v != g.Correlation[j][i] {
+				return fmt.Errorf("correlation must be symmetric ([%d][%d] != [%d][%d])", i, j, j, i)
+			}
+		}
+	}
+	if g.Smoothing < 0 || g.Smoothing >= 1 {
+		return fmt.Errorf("smoothing must be in [0, 1), got %v", g.Smoothing)
+	}
+	if _, err := cholesky(g.Correlation); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate checks the relation's tags, delay and noise.
+func (l LagRelation) Validate() error {
+	if strings.TrimSpace(l.Tag) == "" || strings.TrimSpace(l.Leader) == "" {
+		return fmt.Errorf("tag and leader are required")
+	}
+	if l.Tag == l.Leader {
+		return fmt.Errorf("tag %s cannot follow itself", l.Tag)
+	}
+	if _, err := l.delay(); err != nil {
+		return err
+	}
+	if l.Noise < 0 {
+		return fmt.Errorf("noise must not be negative, got %v", l.Noise)
+	}
+	return nil
+}
+
+func (l LagRelation) delay() (time.Duration, error) {
+	if strings.TrimSpace(l.Delay) == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(l.Delay))
+	if err != nil {
+		return 0, fmt.Errorf("invalid delay %q: %w", l.Delay, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("delay must not be negative, got %s", l.Delay)
+	}
+	return d, nil
+}
+
+// ValidateRelations checks groups and lags together: a tag belongs to at most one group, is
+// not both a group member and a follower, follows at most one leader, and lags have no cycles.
+func ValidateRelations(groups []CorrelationGroup, lags []LagRelation) error {
+	member := map[string]int{}
+	for i, g := range groups {
+		if err := g.Validate(); err != nil {
+			return fmt.Errorf("groups[%d]: %w", i, err)
+		}
+		for _, t := range g.Tags {
+			if j, ok := member[t]; ok {
+				return fmt.Errorf("groups[%d]: tag %s is already in groups[%d]", i, t, j)
+			}
+			member[t] = i
+		}
+	}
+	leaderOf := map[string]string{}
+	for i, l := range lags {
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("lags[%d]: %w", i, err)
+		}
+		if _, ok := member[l.Tag]; ok {
+			return fmt.Errorf("lags[%d]: tag %s is in a correlation group and cannot follow a leader", i, l.Tag)
+		}
+		if _, ok := leaderOf[l.Tag]; ok {
+			return fmt.Errorf("lags[%d]: tag %s already follows a leader", i, l.Tag)
+		}
+		leaderOf[l.Tag] = l.Leader
+	}
+	for tag := range leaderOf {
+		seen := map[string]bool{tag: true}
+		for cur := leaderOf[tag]; cur != ""; cur = leaderOf[cur] {
+			if seen[cur] {
+				return fmt.Errorf("lags: cycle involving tag %s", tag)
+			}
+			seen[cur] = true
+		}
+	}
+	return nil
+}
+
+// orderForLags returns tags reordered so that every leader comes before its followers
+// (otherwise keeping the original order).
+func orderForLags(tags []string, lags []LagRelation) []string {
+	leaderOf := map[string]string{}
+	for _, l := range lags {
+		leaderOf[l.Tag] = l.Leader
+	}
+	depth := func(tag string) int {
+		d := 0
+		for cur := leaderOf[tag]; cur != ""; cur = leaderOf[cur] {
+			d++
+		}
+		return d
+	}
+	ordered := append([]string(nil), tags...)
+	sort.SliceStable(ordered, func(i, j int) bool { return depth(ordered[i]) < depth(ordered[j]) })
+	return ordered
+}
+
+// cholesky returns the lower-triangular L with L*Lᵀ = m, or an error if m is not positive definite.
+func cholesky(m [][]float64) ([][]float64, error) {
+	n := len(m)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			sum := m[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if sum <= 1e-12 {
+					return nil, fmt.Errorf("correlation matrix is not positive definite")
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+	return l, nil
+}
+
+// correlatedProcess generates `steps` samples of a standard-normal vector process whose
+// components have the group's correlation and share the AR(1) smoothing. Returns one
+// series per member, in group order.
+func correlatedProcess(g CorrelationGroup, steps int, rng *rand.Rand) [][]float64 {
+	n := len(g.Tags)
+	l, _ := cholesky(g.Correlation)
+	phi := g.Smoothing
+	innovation := math.Sqrt(1 - phi*phi)
+	out := make([][]float64, n)
+	for i := range out {
+		out[i] = make([]float64, steps)
+	}
+	z := make([]float64, n)
+	x := make([]float64, n)
+	for k := 0; k < steps; k++ {
+		for i := range z {
+			z[i] = rng.NormFloat64()
+		}
+		for i := 0; i < n; i++ {
+			e := 0.0
+			for j := 0; j <= i; j++ {
+				e += l[i][j] * z[j]
+			}
+			if k == 0 {
+				x[i] = e
+			} else {
+				x[i] = phi*x[i] + innovation*e
+			}
+			out[i][k] = x[i]
+		}
+	}
+	return out
+}
+
+// seriesModel replays precomputed standard-normal values scaled to a value range. Value i
+// belongs to start + i*step, so members of a group stay aligned whichever samples they write.
+type seriesModel struct {
+	values     []float64
+	mid, sigma float64
+	start      time.Time
+	step       time.Duration
+}
+
+func (m *seriesModel) Next(t time.Time) float64 {
+	i := int(t.Sub(m.start) / m.step)
+	if i < 0 || i >= len(m.values) {
+		return m.mid
+	}
+	return m.mid + m.sigma*m.values[i]
+}
+
+// followerModel evaluates gain*leader(t-delay) + offset + noise on the leader's series.
+// Before the leader's first sample the first value is used.
+type followerModel struct {
+	leader  []database.SeriesPoint
+	delayMs int64
+	gain    float64
+	offset  float64
+	noise   float64
+	rng     *rand.Rand
+}
+
+func newFollowerModel(rel LagRelation, leader []database.SeriesPoint, rng *rand.Rand) *followerModel {
+	d, _ := rel.delay()
+	gain := 1.0
+	if rel.Gain != nil {
+		gain = *rel.Gain
+	}
+	return &followerModel{leader: leader, delayMs: d.Milliseconds(), gain: gain, offset: rel.Offset, noise: rel.Noise, rng: rng}
+}
+
+func (m *followerModel) Next(t time.Time) float64 {
+	v := m.offset
+	if len(m.leader) > 0 {
+		target := t.UnixMilli() - m.delayMs
+		// last leader sample at or before target
+		i := sort.Search(len(m.leader), func(i int) bool { return m.leader[i].Timestamp > target }) - 1
+		if i < 0 {
+			i = 0
+		}
+		v += m.gain * m.leader[i].Value
+	}
+	if m.noise > 0 {
+		v += m.rng.NormFloat64() * m.noise
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"time"
+
+	"insightsim/internal/database"
+	"insightsim/internal/models"
+)
+
+// counterRange is the wrap range of a counter tag, taken from its profile
+type counterRange struct {
+	min      float64
+	rollover float64 // 0 when unknown: every drop is treated as a reset
+}
+
+// counterRangeOf returns the counter range from a tag profile: min (default 0) and the
+// rollover from the profile's counter model, falling back to the profile max
+func counterRangeOf(profile *TagProfile) counterRange {
+	var c counterRange
+	if profile == nil {
+		return c
+	}
+	if profile.Min != nil {
+		c.min = *profile.Min
+	}
+	if profile.Model != nil && profile.Model.Rollover != nil {
+		c.rollover = *profile.Model.Rollover
+	} else if profile.Max != nil {
+		c.rollover = *profile.Max
+	}
+	return c
+}
+
+// increase returns the counter increase from prev to cur. A drop from the top 10% of
+// [min, rollover) is a rollover; any other drop is a reset, counted from min.
+func (c counterRange) increase(prev, cur float64) float64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	if span := c.rollover - c.min; span > 0 && prev >= c.min+0.9*span {
+		return c.rollover - prev + cur - c.min
+	}
+	return cur - c.min
+}
+
+// counterPoints returns one point per sample with the increase since the previous sample
+// (the first sample uses prev, the last sample before the range, if any). For AggRate the
+// value is divided by the seconds between the two samples.
+func counterPoints(points []database.SeriesPoint, prev *database.SeriesPoint, c counterRange, agg string) []models.DataPoint {
+	result := make([]models.DataPoint, 0, len(points))
+	for i := range points {
+		p := points[i]
+		if prev != nil {
+			v := c.increase(prev.Value, p.Value)
+			if agg == AggRate {
+				secs := float64(p.Timestamp-prev.Timestamp) / 1000
+				if secs <= 0 {
+					prev = &points[i]
+					continue
+				}
+				v /= secs
+			}
+			result = append(result, models.DataPoint{Timestamp: formatTimestamp(p.Timestamp), Value: v, Quality: p.Quality})
+		}
+		prev = &points[i]
+	}
+	return result
+}
+
+// counterBuckets sums counter increases per bucket within [startTs, endTs]. Each
+// increase is spread linearly over the time between its two samples, so an increase that
+// spans a bucket boundary is shared between the buckets. For AggRate the sum is divided by
+// the bucket length in seconds, clipped to [startTs, endTs].
+func counterBuckets(points []database.SeriesPoint, prev *database.SeriesPoint, c counterRange, agg string, buckets bucketing, startTs, endTs int64) []models.DataPoint {
+	var result []models.DataPoint
+	var spans []int64 // covered length of each result bucket in ms
+	add := func(bs time.Time, inc float64, quality int) {
+		iso := formatTimestamp(bs.UnixMilli())
+		if n := len(result); n > 0 && result[n-1].Timestamp == iso {
+			result[n-1].Value += inc
+			if quality > result[n-1].Quality {
+				result[n-1].Quality = quality
+			}
+			return
+		}
+		from, to := max(bs.UnixMilli(), startTs), min(buckets.end(bs).UnixMilli(), endTs)
+		result = append(result, models.DataPoint{Timestamp: iso, Value: inc, Quality: quality})
+		spans = append(spans, to-from)
+	}
+	for i := range points {
+		p := points[i]
+		if prev == nil || p.Timestamp <= prev.Timestamp {
+			prev = &points[i]
+			continue
+		}
+		inc := c.increase(prev.Value, p.Value)
+		perMs := inc / float64(p.Timestamp-prev.Timestamp)
+		for a := max(prev.Timestamp, startTs); a < p.Timestamp; {
+			bs := buckets.start(a)
+			b := min(buckets.end(bs).UnixMilli(), p.Timestamp)
+			add(bs, perMs*float64(b-a), p.Quality)
+			a = b
+		}
+		prev = &points[i]
+	}
+	if agg == AggRate {
+		for i := range result {
+			if spans[i] > 0 {
+				result[i].Value /= float64(spans[i]) / 1000
+			}
+		}
+	}
+	return result
+}
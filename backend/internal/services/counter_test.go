@@ -0,0 +1,112 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"insightsim/internal/database"
+)
+
+func TestCounterIncrease(t *testing.T) {
+	c := counterRange{min: 0, rollover: 100}
+	for _, tc := range []struct {
+		c         counterRange
+		prev, cur float64
+		want      float64
+	}{
+		{c, 10, 20, 10},
+		{c, 20, 20, 0},
+		// A drop from the top 10% is a rollover: the rest up to the rollover plus cur
+		{c, 95, 5, 10},
+		{c, 90, 0, 10},
+		// Any other drop is a reset to min
+		{c, 50, 5, 5},
+		{counterRange{min: 10, rollover: 110}, 60, 15, 5},
+		{counterRange{min: 10, rollover: 110}, 105, 15, 10},
+		// Without a known rollover every drop is a reset
+		{counterRange{}, 95, 5, 5},
+	} {
+		if got := tc.c.increase(tc.prev, tc.cur); got != tc.want {
+			t.Errorf("%+v: increase(%v, %v) = %v, want %v", tc.c, tc.prev, tc.cur, got, tc.want)
+		}
+	}
+}
+
+func TestCounterRangeOf(t *testing.T) {
+	lo, hi, rollover := 10.0, 500.0, 1000.0
+	for _, tc := range []struct {
+		profile *TagProfile
+		want    counterRange
+	}{
+		{nil, counterRange{}},
+		{&TagProfile{Min: &lo, Max: &hi}, counterRange{min: 10, rollover: 500}},
+		{&TagProfile{Max: &hi, Model: &SignalSpec{Type: SignalCounter, Rollover: &rollover}}, counterRange{rollover: 1000}},
+	} {
+		if got := counterRangeOf(tc.profile); got != tc.want {
+			t.Errorf("counterRangeOf(%+v) = %+v, want %+v", tc.profile, got, tc.want)
+		}
+	}
+}
+
+func TestCounterPoints(t *testing.T) {
+	c := counterRange{rollover: 100}
+	prev := &database.SeriesPoint{Timestamp: t0 - 60000, Value: 95, Quality: 3}
+	points := []database.SeriesPoint{
+		{Timestamp: t0, Value: 5, Quality: 3},
+		{Timestamp: t0 + 60000, Value: 17, Quality: 1},
+		{Timestamp: t0 + 120000, Value: 17, Quality: 3},
+	}
+
+	delta := counterPoints(points, prev, c, AggDelta)
+	want := []float64{10, 12, 0}
+	if len(delta) != len(want) {
+		t.Fatalf("delta = %+v, want %v", delta, want)
+	}
+	for i, p := range delta {
+		if p.Value != want[i] || p.Timestamp != formatTimestamp(points[i].Timestamp) || p.Quality != points[i].Quality {
+			t.Errorf("delta %d = %+v, want %v at %s", i, p, want[i], formatTimestamp(points[i].Timestamp))
+		}
+	}
+
+	// Without a sample before the range the first sample has no increase
+	rate := counterPoints(points, nil, c, AggRate)
+	if len(rate) != 2 || math.Abs(rate[0].Value-0.2) > 1e-12 || rate[1].Value != 0 {
+		t.Errorf("rate = %+v, want 0.2 and 0 per second", rate)
+	}
+}
+
+func TestCounterBuckets(t *testing.T) {
+	const minute = 60000
+	c := counterRange{rollover: 100}
+	hourly := bucketing{step: 60 * minute}
+	sample := func(ts int64, v float64) database.SeriesPoint {
+		return database.SeriesPoint{Timestamp: ts, Value: v, Quality: 3}
+	}
+	for _, tc := range []struct {
+		name   string
+		points []database.SeriesPoint
+		prev   *database.SeriesPoint
+		agg    string
+		want   []float64
+	}{
+		// An increase spanning a bucket boundary is shared in proportion to time
+		{"spread", []database.SeriesPoint{sample(t0+30*minute, 0), sample(t0+90*minute, 60)}, nil, AggDelta, []float64{30, 30}},
+		// A rollover between 95 and 5 is an increase of 10
+		{"rollover", []database.SeriesPoint{sample(t0+50*minute, 95), sample(t0+70*minute, 5)}, nil, AggDelta, []float64{5, 5}},
+		// Only the part of the increase after the range start counts
+		{"before start", []database.SeriesPoint{sample(t0+30*minute, 60)}, &database.SeriesPoint{Timestamp: t0 - 30*minute, Value: 0}, AggDelta,
+			[]float64{30}},
+		{"rate", []database.SeriesPoint{sample(t0+30*minute, 0), sample(t0+90*minute, 72)}, nil, AggRate, []float64{0.01, 0.01}},
+	} {
+		got := counterBuckets(tc.points, tc.prev, c, tc.agg, hourly, t0, t0+120*minute)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: %+v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i, p := range got {
+			if math.Abs(p.Value-tc.want[i]) > 1e-9 {
+				t.Errorf("%s: bucket %d = %v, want %v", tc.name, i, p.Value, tc.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"math"
+	"strconv"
+
+	"insightsim/internal/database"
+	"insightsim/internal/models"
+)
+
+// stateBucket accumulates the state statistics of one bucket
+type stateBucket struct {
+	point       models.DataPoint
+	seconds     map[float64]float64 // state -> seconds
+	transitions int
+	last        float64
+}
+
+// stateBuckets evaluates a state aggregation (time_in_state, transitions, last_state) per
+// bucket within [startTs, endTs]. Samples hold their state until the next sample
+// (the last one until endTs); the sample before startTs, if any, gives the initial state.
+// Without buckets (aggregate=raw) the whole range is a single bucket.
+func stateBuckets(points []database.SeriesPoint, prev *database.SeriesPoint, labels map[int]string, agg string, bucketing bucketing, startTs, endTs int64) []models.DataPoint {
+	single := bucketing.raw()
+	var buckets []*stateBucket
+	index := make(map[int64]*stateBucket)
+	bucketAt := func(ts int64) (*stateBucket, int64) {
+		bs, be := startTs, endTs
+		if !single {
+			start := bucketing.start(ts)
+			bs, be = start.UnixMilli(), bucketing.end(start).UnixMilli()
+		}
+		b, ok := index[bs]
+		if !ok {
+			b = &stateBucket{point: models.DataPoint{Timestamp: formatTimestamp(bs)}, seconds: make(map[float64]float64)}
+			index[bs] = b
+			buckets = append(buckets, b)
+		}
+		return b, be
+	}
+	hold := func(p *database.SeriesPoint, from, to int64) {
+		for a := max(from, startTs); a < to; {
+			b, be := bucketAt(a)
+			end := min(be, to)
+			b.seconds[p.Value] += float64(end-a) / 1000
+			b.last = p.Value
+			if p.Quality > b.point.Quality {
+				b.point.Quality = p.Quality
+			}
+			a = end
+		}
+	}
+
+	for i := range points {
+		p := &points[i]
+		if prev != nil {
+			hold(prev, prev.Timestamp, p.Timestamp)
+		}
+		b, _ := bucketAt(p.Timestamp)
+		if prev != nil && p.Value != prev.Value {
+			b.transitions++
+		}
+		b.last = p.Value
+		if p.Quality > b.point.Quality {
+			b.point.Quality = p.Quality
+		}
+		prev = p
+	}
+	if prev != nil {
+		hold(prev, prev.Timestamp, endTs)
+	}
+
+	result := make([]models.DataPoint, 0, len(buckets))
+	for _, b := range buckets {
+		p := b.point
+		switch agg {
+		case AggTimeInState:
+			// Value is the state held longest in the bucket (the sampled state for a bucket
+			// that only contains a sample at endTs)
+			p.States = make(map[string]float64, len(b.seconds))
+			p.Value = b.last
+			longest := -1.0
+			for state, secs := range b.seconds {
+				p.States[stateLabel(state, labels)] = secs
+				if secs > longest || (secs == longest && state < p.Value) {
+					longest, p.Value = secs, state
+				}
+			}
+		case AggTransitions:
+			p.Value = float64(b.transitions)
+		default: // last_state
+			p.Value = b.last
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// stateLabel returns the label of a state code, or the code itself when it has none
+func stateLabel(state float64, labels map[int]string) string {
+	if state == math.Trunc(state) {
+		if label, ok := labels[int(state)]; ok {
+			return label
+		}
+	}
+	return strconv.FormatFloat(state, 'f', -1, 64)
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+// ErrInsufficientData is returned when a tag has too little history to fit
+var ErrInsufficientData = errors.New("insufficient data")
+
+// ErrInvalidFitOptions wraps invalid fit options (time range, time zone)
+var ErrInvalidFitOptions = errors.New("invalid fit options")
+
+// minFitSamples is the minimum number of samples needed to fit a tag
+const minFitSamples = 24
+
+// TagFit is a statistical profile learned from a tag's history. A tag whose model is
+// {"type": "fitted", "source": <tag>} generates a synthetic lookalike from it.
+type TagFit struct {
+	Tag             string          `json:"tag"`
+	Samples         int             `json:"samples"`
+	Start           string          `json:"start"`
+	End             string          `json:"end"`
+	TimeZone        string          `json:"timezone,omitempty"` // Zone of the daily/weekend profile (default UTC)
+	Interval        string          `json:"interval"`           // Median sampling interval
+	Min             float64         `json:"min"`
+	Max             float64         `json:"max"`
+	Mean            float64         `json:"mean"`
+	StdDev          float64         `json:"std_dev"`
+	Quantiles       []float64       `json:"quantiles"`         // Percentiles 0..100 of the deseasonalized values
+	Autocorrelation float64         `json:"autocorrelation"`   // Lag-1 autocorrelation at Interval
+	Daily           []float64       `json:"daily,omitempty"`   // Offset from the mean per local hour 0..23
+	Weekend         float64         `json:"weekend,omitempty"` // Extra offset on Saturdays and Sundays
+	MissingFraction float64         `json:"missing_fraction"`  // Share of expected samples that are missing
+	MeanGap         float64         `json:"mean_gap"`          // Mean number of missing samples per gap
+	Quality         []QualityWeight `json:"quality"`           // Share of each quality code
+	CreatedAt       string          `json:"created_at"`
+}
+
+// FitOptions limits the history used for a fit
+type FitOptions struct {
+	Start    string `json:"start,omitempty"`    // Optional: ISO 8601 (local time in TimeZone without an offset), default the first sample
+	End      string `json:"end,omitempty"`      // Optional: ISO 8601 (local time in TimeZone without an offset), default the last sample
+	TimeZone string `json:"timezone,omitempty"` // Optional: IANA zone of the daily/weekend profile and of start/end
+}
+
+// FitService learns statistical profiles from stored history
+type FitService struct {
+	db *database.DB
+}
+
+// NewFitService creates a new FitService
+func NewFitService(db *database.DB) *FitService {
+	return &FitService{db: db}
+}
+
+// Fit analyses the tag's history in insight_raws and stores the resulting profile
+func (s *FitService) Fit(tag string, opts FitOptions) (*TagFit, error) {
+	if _, found, err := s.db.GetTagProfile(tag); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, ErrTagNotFound
+	}
+	loc, err := LoadTimeZone(opts.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFitOptions, err)
+	}
+	// Start and end without an offset are local time in the fit's zone
+	startTs, endTs := int64(math.MinInt64), int64(math.MaxInt64)
+	if opts.Start != "" {
+		if startTs, err = parseTimestampInLocation(opts.Start, loc); err != nil {
+			return nil, fmt.Errorf("%w: invalid start time: %v", ErrInvalidFitOptions, err)
+		}
+	}
+	if opts.End != "" {
+		if endTs, err = parseTimestampInLocation(opts.End, loc); err != nil {
+			return nil, fmt.Errorf("%w: invalid end time: %v", ErrInvalidFitOptions, err)
+		}
+	}
+	points, err := s.db.ReadSeries(tag, startTs, endTs)
+	if err != nil {
+		return nil, err
+	}
+	fit, err := fitSeries(points, loc)
+	if err != nil {
+		return nil, err
+	}
+	fit.Tag = tag
+	fit.TimeZone = opts.TimeZone
+	fit.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.Marshal(fit)
+	if err != nil {
+		return nil, fmt.Errorf("encode fit: %w", err)
+	}
+	if err := s.db.SetTagFit(tag, string(data), fit.CreatedAt); err != nil {
+		return nil, err
+	}
+	fmt.Printf("[FIT] Fitted tag %s: %d samples, interval %s, autocorrelation %.3f, missing %.1f%%\n",
+		tag, fit.Samples, fit.Interval, fit.Autocorrelation, fit.MissingFraction*100)
+	return fit, nil
+}
+
+// Get returns the stored fit of a tag
+func (s *FitService) Get(tag string) (*TagFit, error) {
+	return loadTagFit(s.db, tag)
+}
+
+// Delete removes the stored fit of a tag
+func (s *FitService) Delete(tag string) error {
+	if _, err := loadTagFit(s.db, tag); err != nil {
+		return err
+	}
+	return s.db.DeleteTagFit(tag)
+}
+
+// loadTagFit reads a stored fit (ErrTagNotFound if the tag has none)
+func loadTagFit(db *database.DB, tag string) (*TagFit, error) {
+	raw, found, err := db.GetTagFit(tag)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrTagNotFound
+	}
+	var fit TagFit
+	if err := json.Unmarshal([]byte(raw), &fit); err != nil {
+		return nil, fmt.Errorf("invalid stored fit for tag %s: %w", tag, err)
+	}
+	return &fit, nil
+}
+
+// fitSeries computes the statistics of a series (sorted by timestamp)
+func fitSeries(points []database.SeriesPoint, loc *time.Location) (*TagFit, error) {
+	n := len(points)
+	if n < minFitSamples {
+		return nil, fmt.Errorf("%w: %d samples, need at least %d", ErrInsufficientData, n, minFitSamples)
+	}
+	fit := &TagFit{
+		Samples: n,
+		Start:   formatTimestamp(points[0].Timestamp),
+		End:     formatTimestamp(points[n-1].Timestamp),
+		Min:     points[0].Value,
+		Max:     points[0].Value,
+	}
+
+	// Sampling interval: median step between samples
+	steps := make([]int64, 0, n-1)
+	for i := 1; i < n; i++ {
+		steps = append(steps, points[i].Timestamp-points[i-1].Timestamp)
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i] < steps[j] })
+	interval := steps[len(steps)/2]
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: samples have no time spacing", ErrInsufficientData)
+	}
+	fit.Interval = (time.Duration(interval) * time.Millisecond).String()
+
+	// Distribution and quality mix
+	qualities := make(map[int]int)
+	sum := 0.0
+	for _, p := range points {
+		sum += p.Value
+		fit.Min = math.Min(fit.Min, p.Value)
+		fit.Max = math.Max(fit.Max, p.Value)
+		qualities[p.Quality]++
+	}
+	fit.Mean = sum / float64(n)
+	variance := 0.0
+	for _, p := range points {
+		variance += (p.Value - fit.Mean) * (p.Value - fit.Mean)
+	}
+	fit.StdDev = math.Sqrt(variance / float64(n))
+	codes := make([]int, 0, len(qualities))
+	for code := range qualities {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fit.Quality = append(fit.Quality, QualityWeight{Code: code, Weight: float64(qualities[code]) / float64(n)})
+	}
+
+	// Seasonality: hourly offsets from the mean, then a weekend offset on what remains.
+	// Only fitted when the history covers at least two days.
+	residual := make([]float64, n)
+	for i, p := range points {
+		residual[i] = p.Value
+	}
+	if points[n-1].Timestamp-points[0].Timestamp >= 2*24*time.Hour.Milliseconds() {
+		var hourSum [24]float64
+		var hourCount [24]int
+		for _, p := range points {
+			h := time.UnixMilli(p.Timestamp).In(loc).Hour()
+			hourSum[h] += p.Value
+			hourCount[h]++
+		}
+		fit.Daily = make([]float64, 24)
+		for h := range fit.Daily {
+			if hourCount[h] > 0 {
+				fit.Daily[h] = hourSum[h]/float64(hourCount[h]) - fit.Mean
+			}
+		}
+		var weSum, wdSum float64
+		var weCount, wdCount int
+		for i, p := range points {
+			t := time.UnixMilli(p.Timestamp).In(loc)
+			residual[i] -= fit.Daily[t.Hour()]
+			if isWeekend(t) {
+				weSum += residual[i]
+				weCount++
+			} else {
+				wdSum += residual[i]
+				wdCount++
+			}
+		}
+		if weCount > 0 && wdCount > 0 {
+			fit.Weekend = weSum/float64(weCount) - wdSum/float64(wdCount)
+			for i, p := range points {
+				if isWeekend(time.UnixMilli(p.Timestamp).In(loc)) {
+					residual[i] -= fit.Weekend
+				}
+			}
+		}
+	}
+
+	// Percentiles of the deseasonalized values
+	sorted := append([]float64(nil), residual...)
+	sort.Float64s(sorted)
+	fit.Quantiles = make([]float64, 101)
+	for q := range fit.Quantiles {
+		pos := float64(q) / 100 * float64(n-1)
+		i := int(pos)
+		if i >= n-1 {
+			fit.Quantiles[q] = sorted[n-1]
+			continue
+		}
+		fit.Quantiles[q] = sorted[i] + (sorted[i+1]-sorted[i])*(pos-float64(i))
+	}
+
+	// Lag-1 autocorrelation over pairs one interval apart (±10%)
+	mean := 0.0
+	for _, r := range residual {
+		mean += r
+	}
+	mean /= float64(n)
+	var cov, varA, varB float64
+	for i := 1; i < n; i++ {
+		dt := points[i].Timestamp - points[i-1].Timestamp
+		if math.Abs(float64(dt-interval)) > 0.1*float64(interval) {
+			continue
+		}
+		a, b := residual[i-1]-mean, residual[i]-mean
+		cov += a * b
+		varA += a * a
+		varB += b * b
+	}
+	if varA > 0 && varB > 0 {
+		fit.Autocorrelation = math.Max(-0.999, math.Min(0.999, cov/math.Sqrt(varA*varB)))
+	}
+
+	// Gaps: steps longer than 1.5 intervals
+	gaps, missing := 0, 0
+	for _, step := range steps {
+		if float64(step) > 1.5*float64(interval) {
+			gaps++
+			missing += int(math.Round(float64(step)/float64(interval))) - 1
+		}
+	}
+	if missing > 0 {
+		fit.MissingFraction = float64(missing) / float64(missing+n)
+		fit.MeanGap = float64(missing) / float64(gaps)
+	}
+	return fit, nil
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// interval returns the fitted sampling interval rounded to whole seconds (at least MinInterval)
+func (f *TagFit) interval() time.Duration {
+	d, err := time.ParseDuration(f.Interval)
+	if err != nil {
+		return DefaultInterval
+	}
+	return max(MinInterval, d.Round(time.Second))
+}
+
+// fittedModel generates a lookalike of a fitted series: an AR(1) gaussian process with the
+// fitted autocorrelation, mapped through the fitted percentiles, plus the daily and weekend
+// offsets. It also reproduces the fitted gaps (see missing).
+type fittedModel struct {
+	fit     *TagFit
+	loc     *time.Location
+	rng     *rand.Rand
+	z       float64
+	started bool
+	gapProb float64 // probability that a gap starts at a sample
+	gapLeft int     // samples still missing in the current gap
+}
+
+func newFittedModel(fit *TagFit, rng *rand.Rand) *fittedModel {
+	loc, err := LoadTimeZone(fit.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	m := &fittedModel{fit: fit, loc: loc, rng: rng}
+	if fit.MissingFraction > 0 && fit.MissingFraction < 1 && fit.MeanGap > 0 {
+		m.gapProb = fit.MissingFraction / ((1 - fit.MissingFraction) * fit.MeanGap)
+	}
+	return m
+}
+
+func (m *fittedModel) Next(t time.Time) float64 {
+	phi := m.fit.Autocorrelation
+	if !m.started {
+		m.z = m.rng.NormFloat64()
+		m.started = true
+	} else {
+		m.z = phi*m.z + math.Sqrt(1-phi*phi)*m.rng.NormFloat64()
+	}
+	u := 0.5 * math.Erfc(-m.z/math.Sqrt2)
+	v := m.quantile(u)
+	local := t.In(m.loc)
+	if len(m.fit.Daily) == 24 {
+		v += m.fit.Daily[local.Hour()]
+	}
+	if isWeekend(local) {
+		v += m.fit.Weekend
+	}
+	return v
+}
+
+// quantile interpolates the fitted percentiles at u in [0, 1]
+func (m *fittedModel) quantile(u float64) float64 {
+	q := m.fit.Quantiles
+	if len(q) == 0 {
+		return m.fit.Mean
+	}
+	pos := u * float64(len(q)-1)
+	i := int(pos)
+	if i >= len(q)-1 {
+		return q[len(q)-1]
+	}
+	return q[i] + (q[i+1]-q[i])*(pos-float64(i))
+}
+
+// missing reports whether the current sample falls in a simulated gap
+func (m *fittedModel) missing() bool {
+	if m.gapLeft > 0 {
+		m.gapLeft--
+		return true
+	}
+	if m.gapProb > 0 && m.rng.Float64() < m.gapProb {
+		// Geometric gap length with the fitted mean
+		length := 1
+		if m.fit.MeanGap > 1 {
+			length += int(math.Log(1-m.rng.Float64()) / math.Log(1-1/m.fit.MeanGap))
+		}
+		m.gapLeft = length - 1
+		return true
+	}
+	return false
+}
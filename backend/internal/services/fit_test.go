@@ -0,0 +1,20 @@
+package services
+
+import "testing"
+
+// TestFitRangeInTimeZone checks that a fit's start and end are local time in its zone
+func TestFitRangeInTimeZone(t *testing.T) {
+	db := openTestDB(t, "A")
+	generate(t, db, GenerateOptions{StartTime: "2026-01-01T00:00:00", EndTime: "2026-01-01T02:00:00"})
+	fit, err := NewFitService(db).Fit("A", FitOptions{
+		Start:    "2026-01-01T07:30:00",
+		End:      "2026-01-01T08:30:00",
+		TimeZone: "Asia/Ho_Chi_Minh", // UTC+7
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fit.Start != "2026-01-01T00:30:00" || fit.End != "2026-01-01T01:30:00" {
+		t.Errorf("fit range %s to %s, want 2026-01-01T00:30:00 to 2026-01-01T01:30:00 (UTC)", fit.Start, fit.End)
+	}
+}
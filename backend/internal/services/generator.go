@@ -1,18 +1,24 @@
 package services
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"insightsim/internal/database"
+	"insightsim/internal/expr"
 )
 
 // Generator handles generating dummy timeseries data
 type Generator struct {
-	db *database.DB
+	db      *database.DB
+	workers int // default synthesis workers of a run (0 = number of CPUs)
 }
 
 // NewGenerator creates a new Generator instance
@@ -20,22 +26,246 @@ func NewGenerator(db *database.DB) *Generator {
 	return &Generator{db: db}
 }
 
+// SetWorkers sets the default number of tags synthesized concurrently (<= 0 uses the number of CPUs)
+func (g *Generator) SetWorkers(n int) {
+	g.workers = n
+}
+
+// Write modes of a generation run
+const (
+	WriteReplace     = "replace"       // delete the tag's records, then generate the range (default)
+	WriteAppend      = "append"        // keep records, continue each tag after its last record
+	WriteFillGaps    = "fill-gaps"     // keep records, generate only the samples missing in the range
+	WriteExtendToNow = "extend-to-now" // like append, with the range ending now
+)
+
+// ParseWriteMode normalizes a write mode ("" means replace)
+func ParseWriteMode(mode string) (string, error) {
+	switch strings.ReplaceAll(strings.ToLower(strings.TrimSpace(mode)), "_", "-") {
+	case "", WriteReplace:
+		return WriteReplace, nil
+	case WriteAppend:
+		return WriteAppend, nil
+	case WriteFillGaps:
+		return WriteFillGaps, nil
+	case WriteExtendToNow:
+		return WriteExtendToNow, nil
+	}
+	return "", fmt.Errorf("unknown write mode %q (expected replace, append, fill-gaps or extend-to-now)", mode)
+}
+
+// generateCommitRows is the number of records per transaction of a generation run
+const generateCommitRows = 10000
+
 // OnTagComplete is called after each tag's data generation finishes (optional, may be nil).
 type OnTagComplete func(tag string, records int)
 
+// GenerateOptions holds the parameters of a GenerateDummyData run.
+type GenerateOptions struct {
+	MinValue    float64
+	MaxValue    float64
+	StartTime   string                // Format 2006-01-02T15:04:05 in TimeZone. Empty uses the default range.
+	EndTime     string                // Format 2006-01-02T15:04:05 in TimeZone. Empty uses the default range.
+	TimeZone    string                // Optional: IANA zone for the time range and seasonality (default UTC)
+	Tag         string                // Optional: only generate for this tag
+	Tags        []string              // Optional: only generate (and in replace mode delete) these tags (ignored when Tag is set)
+	Interval    time.Duration         // Step between records, at least MinInterval (0 = DefaultInterval)
+	Model       SignalSpec            // Signal model used for every tag (empty type = random)
+	TagModels   map[string]SignalSpec // Optional per-tag overrides of Model
+	Seed        *int64                // Optional: run seed for reproducible values. Nil picks one from the clock.
+	Anomalies   []AnomalySpec         // Optional: events injected into the generated data
+	Quality     *QualitySpec          // Optional: quality code model (default: fixed quality 3)
+	Groups      []CorrelationGroup    // Optional: tags generated jointly with a target correlation matrix
+	Lags        []LagRelation         // Optional: tags that follow a leader tag with a delay
+	Seasonality *SeasonalitySpec      // Optional: calendar effects for every tag (a tag profile overrides it)
+	Sampling    *SamplingSpec         // Optional: sample timing and exception recording for every tag (a tag profile overrides it)
+	Mode        string                // Optional: write mode (WriteReplace, WriteAppend, WriteFillGaps, WriteExtendToNow). Default replace.
+	OnStart     func(tags int)        // Optional: called with the number of tags to process before any data is written
+	BatchSize   int                   // Optional: rows per INSERT statement (default: database.write_batch_size in config)
+	Workers     int                   // Optional: tags synthesized concurrently (default: the generator's setting)
+}
+
+// GenerateResult summarises a GenerateDummyData run.
+type GenerateResult struct {
+	Records int                 // Records written
+	Tags    int                 // Tags processed
+	Seed    int64               // Effective run seed; pass it back as GenerateOptions.Seed to reproduce the run
+	Write   database.WriteStats // Throughput of the generated (not calculated) records
+}
+
+// tagRand returns the random source for one tag of a run. It depends only on the run
+// seed and the tag name, so regenerating a single tag reproduces its values from a full run.
+func tagRand(seed int64, tag string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(tag))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
+
+// tagPlan is the effective generation settings of one tag
+type tagPlan struct {
+	model       SignalSpec
+	minValue    float64
+	maxValue    float64
+	interval    time.Duration
+	noise       float64
+	sampling    *SamplingSpec
+	quality     *QualitySpec
+	seasonality *SeasonalitySpec
+	fit         *TagFit // fitted model: the source tag's fit
+}
+
+// planFor resolves the settings of tag. Precedence: per-request tag model, then the
+// tag's stored profile, then (for a fitted model) the fit, then the request defaults.
+func (o GenerateOptions) planFor(tag string, profile *TagProfile, loadFit func(tag string) (*TagFit, error)) (tagPlan, error) {
+	plan := tagPlan{
+		model:       o.Model,
+		minValue:    o.MinValue,
+		maxValue:    o.MaxValue,
+		interval:    o.Interval,
+		sampling:    o.Sampling,
+		quality:     o.Quality,
+		seasonality: o.Seasonality,
+	}
+	if profile != nil {
+		if profile.Model != nil {
+			plan.model = *profile.Model
+		}
+		if profile.Min != nil {
+			plan.minValue = *profile.Min
+		}
+		if profile.Max != nil {
+			plan.maxValue = *profile.Max
+		}
+		interval, err := profile.interval()
+		if err != nil {
+			return plan, err
+		}
+		if interval > 0 {
+			plan.interval = interval
+		}
+		plan.noise = profile.Noise
+		if profile.Quality != nil {
+			plan.quality = profile.Quality
+		}
+		if profile.Seasonality != nil {
+			plan.seasonality = profile.Seasonality
+		}
+		if profile.Sampling != nil {
+			plan.sampling = profile.Sampling
+		}
+	}
+	if spec, ok := o.TagModels[tag]; ok {
+		plan.model = spec
+	}
+	if normalizeSignalType(plan.model.Type) == SignalFitted {
+		source := plan.model.Source
+		if source == "" {
+			source = tag
+		}
+		fit, err := loadFit(source)
+		if err != nil {
+			if err == ErrTagNotFound {
+				return plan, fmt.Errorf("fitted model: tag %s has no fit (POST /api/tags/%s/fit first)", source, source)
+			}
+			return plan, err
+		}
+		plan.fit = fit
+		if (profile == nil || (profile.Min == nil && profile.Max == nil)) && fit.Max > fit.Min {
+			plan.minValue, plan.maxValue = fit.Min, fit.Max
+		}
+		if profile == nil || profile.Interval == "" {
+			plan.interval = fit.interval()
+		}
+		if profile == nil || profile.Quality == nil {
+			plan.quality = &QualitySpec{Weights: fit.Quality}
+		}
+		if d := plan.sampling.interval(); d > 0 {
+			plan.interval = d
+		}
+		return plan, nil
+	}
+	if plan.interval <= 0 {
+		plan.interval = DefaultInterval
+	}
+	// A sampling interval overrides the request, profile and fitted intervals
+	if d := plan.sampling.interval(); d > 0 {
+		plan.interval = d
+	}
+	if plan.minValue >= plan.maxValue {
+		return plan, fmt.Errorf("min (%v) must be less than max (%v)", plan.minValue, plan.maxValue)
+	}
+	// Catch range-dependent model errors (e.g. counter rollover) before any data is deleted
+	if _, err := NewSignalModel(plan.model, plan.minValue, plan.maxValue, rand.New(rand.NewSource(0))); err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
+
 // GenerateDummyData generates dummy data for tags from the tags table in the DB.
-// If singleTag is provided, only generate for that tag; otherwise generate for all tags.
-// intervalMinutes is the step between records (1, 5, 15, 30, or 60). Must be >= 1.
+// If opts.Tag is provided, only generate for that tag; otherwise generate for all tags.
 // If onTagComplete is non-nil, it is called after each tag completes with the tag name and record count.
-func (g *Generator) GenerateDummyData(minValue, maxValue float64, useSequential bool, startTimeStr, endTimeStr string, singleTag string, intervalMinutes int, onTagComplete OnTagComplete) (int, int, error) {
+// Cancelling ctx stops the run with ctx's error: the open batch is rolled back, while batches
+// already committed (every 10,000 records) and completed tags are kept.
+func (g *Generator) GenerateDummyData(ctx context.Context, opts GenerateOptions, onTagComplete OnTagComplete) (*GenerateResult, error) {
 	generateStartTime := time.Now()
+	startTimeStr, endTimeStr := opts.StartTime, opts.EndTime
+	singleTag := opts.Tag
+	interval := opts.Interval
+
+	if err := opts.Model.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid model: %w", err)
+	}
+	for tag, spec := range opts.TagModels {
+		if err := spec.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid model for tag %s: %w", tag, err)
+		}
+	}
+	for i, spec := range opts.Anomalies {
+		if err := spec.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid anomalies[%d]: %w", i, err)
+		}
+	}
+	if opts.Quality != nil {
+		if err := opts.Quality.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid quality: %w", err)
+		}
+	}
+	if err := ValidateRelations(opts.Groups, opts.Lags); err != nil {
+		return nil, fmt.Errorf("invalid correlation: %w", err)
+	}
+	if opts.Seasonality != nil {
+		if err := opts.Seasonality.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid seasonality: %w", err)
+		}
+	}
+	if opts.Sampling != nil {
+		if err := opts.Sampling.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid sampling: %w", err)
+		}
+	}
+	loc, err := LoadTimeZone(opts.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := ParseWriteMode(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if mode == WriteFillGaps && len(opts.Anomalies) > 0 {
+		// Events would be labelled over stored samples that are kept unchanged
+		return nil, fmt.Errorf("anomalies are not supported with write mode %s", mode)
+	}
 
 	tags, err := g.db.ListTagNamesFromTagsTable()
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to list tags from DB: %w", err)
+		return nil, fmt.Errorf("failed to list tags from DB: %w", err)
 	}
 	if len(tags) == 0 {
-		return 0, 0, fmt.Errorf("no tags found in database (add tags via API first)")
+		return nil, fmt.Errorf("no tags found in database (add tags via API first)")
+	}
+	knownTags := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		knownTags[t] = true
 	}
 
 	// Filter to single tag if specified
@@ -49,14 +279,90 @@ func (g *Generator) GenerateDummyData(minValue, maxValue float64, useSequential
 			}
 		}
 		if !found {
-			return 0, 0, fmt.Errorf("tag '%s' not found in tag list", singleTag)
+			return nil, fmt.Errorf("tag '%s' not found in tag list", singleTag)
 		}
 		tags = []string{singleTag}
 		fmt.Printf("[GENERATE] Filtered to single tag: %s\n", singleTag)
+	} else if len(opts.Tags) > 0 {
+		selected := make([]string, 0, len(opts.Tags))
+		seen := make(map[string]bool, len(opts.Tags))
+		for _, t := range opts.Tags {
+			t = strings.TrimSpace(t)
+			if !knownTags[t] {
+				return nil, fmt.Errorf("tag '%s' not found in tag list", t)
+			}
+			if !seen[t] {
+				seen[t] = true
+				selected = append(selected, t)
+			}
+		}
+		tags = selected
+		fmt.Printf("[GENERATE] Filtered to %d tags\n", len(tags))
 	}
 
 	fmt.Printf("[GENERATE] Using %d tags from DB\n", len(tags))
 
+	// Calculated tags are not synthesized: they are materialized from their inputs afterwards.
+	// Regenerating a subset of input tags also refreshes the calculated tags that depend on them.
+	calcDefs, err := loadCalculatedDefs(g.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load calculated tags: %w", err)
+	}
+	var calcTags []string
+	baseTags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if calcDefs[tag] != nil {
+			calcTags = append(calcTags, tag)
+		} else {
+			baseTags = append(baseTags, tag)
+		}
+	}
+	if singleTag != "" || len(opts.Tags) > 0 {
+		selected := make(map[string]bool, len(tags))
+		for _, t := range tags {
+			selected[t] = true
+		}
+		for name, e := range calcDefs {
+			if selected[name] {
+				continue
+			}
+			for _, in := range e.Vars() {
+				if selected[in] {
+					calcTags = append(calcTags, name)
+					break
+				}
+			}
+		}
+		sort.Strings(calcTags)
+	}
+	tags = baseTags
+
+	// Tags in groups and lag relations must be existing, non-calculated tags
+	checkRelationTag := func(where, tag string) error {
+		if !knownTags[tag] {
+			return fmt.Errorf("%s: tag '%s' not found in tag list", where, tag)
+		}
+		if calcDefs[tag] != nil {
+			return fmt.Errorf("%s: %s is a calculated tag", where, tag)
+		}
+		return nil
+	}
+	for i, group := range opts.Groups {
+		for _, t := range group.Tags {
+			if err := checkRelationTag(fmt.Sprintf("groups[%d]", i), t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, rel := range opts.Lags {
+		for _, t := range []string{rel.Tag, rel.Leader} {
+			if err := checkRelationTag(fmt.Sprintf("lags[%d]", i), t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	tags = orderForLags(tags, opts.Lags)
+
 	// Parse time range from config
 	timeFormat := "2006-01-02T15:04:05"
 
@@ -68,242 +374,649 @@ func (g *Generator) GenerateDummyData(minValue, maxValue float64, useSequential
 		endTimeStr = "2026-01-31T23:59:59"
 	}
 
-	startTime, err := time.Parse(timeFormat, startTimeStr)
+	// The range is given in the run's time zone; timestamps are stored as UTC millis
+	startTime, err := time.ParseInLocation(timeFormat, startTimeStr, loc)
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid generation_start_time format '%s': %w (expected format: %s)", startTimeStr, err, timeFormat)
+		return nil, fmt.Errorf("invalid generation_start_time format '%s': %w (expected format: %s)", startTimeStr, err, timeFormat)
 	}
 	startTime = startTime.UTC()
 
-	endTime, err := time.Parse(timeFormat, endTimeStr)
+	endTime, err := time.ParseInLocation(timeFormat, endTimeStr, loc)
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid generation_end_time format '%s': %w (expected format: %s)", endTimeStr, err, timeFormat)
+		return nil, fmt.Errorf("invalid generation_end_time format '%s': %w (expected format: %s)", endTimeStr, err, timeFormat)
 	}
 	endTime = endTime.UTC()
+	if mode == WriteExtendToNow {
+		// Each tag continues on its own step up to now (timestamps are whole milliseconds)
+		endTime = time.Now().UTC().Truncate(time.Millisecond)
+		endTimeStr = endTime.In(loc).Format(timeFormat)
+	}
 
 	// Validate that start time is before end time
 	if startTime.After(endTime) || startTime.Equal(endTime) {
-		return 0, 0, fmt.Errorf("invalid time range: generation_start_time (%s) must be before generation_end_time (%s)", startTimeStr, endTimeStr)
+		return nil, fmt.Errorf("invalid time range: generation_start_time (%s) must be before generation_end_time (%s)", startTimeStr, endTimeStr)
 	}
 
-	if intervalMinutes < 1 {
-		intervalMinutes = 1
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if interval < MinInterval {
+		return nil, fmt.Errorf("invalid interval %s: must be at least %s", interval, MinInterval)
 	}
 
-	// Calculate total minutes
-	totalMinutes := int(endTime.Sub(startTime).Minutes()) + 1
-
-	// Delete existing records before generating new batch
-	conn := g.db.GetConn()
-	deleteStart := time.Now()
-	if singleTag != "" {
-		// Delete only records for the specific tag
-		fmt.Printf("[GENERATE] Deleting existing records for tag: %s...\n", singleTag)
-		if err := g.db.DeleteTagRecords(singleTag); err != nil {
-			return 0, 0, fmt.Errorf("failed to delete existing records for tag %s: %w", singleTag, err)
+	// In replace mode, lag leaders outside the run (and their own leaders) without stored
+	// records in range are synthesized in memory without being stored, so a follower
+	// generated alone gets the same clean leader values as in a full run with the same seed.
+	// A leader with stored (e.g. imported) records is followed from them, unless the relation
+	// asks to resynthesize it.
+	var shadowTags []string
+	shadowed := make(map[string]bool)
+	if mode == WriteReplace {
+		leaderOf := make(map[string]LagRelation, len(opts.Lags))
+		for _, rel := range opts.Lags {
+			leaderOf[rel.Tag] = rel
 		}
-		fmt.Printf("[GENERATE] Deleted existing records for tag %s (took %v)\n", singleTag, time.Since(deleteStart).Round(time.Millisecond))
-	} else {
-		// Delete all existing records
-		fmt.Printf("[GENERATE] Deleting all existing records...\n")
-		if err := g.db.DeleteAllRecords(); err != nil {
-			return 0, 0, fmt.Errorf("failed to delete existing records: %w", err)
+		included := make(map[string]bool, len(tags))
+		for _, t := range tags {
+			included[t] = true
+		}
+		pending := append([]string(nil), tags...)
+		for len(pending) > 0 {
+			rel, ok := leaderOf[pending[0]]
+			pending = pending[1:]
+			if !ok || included[rel.Leader] {
+				continue
+			}
+			included[rel.Leader] = true
+			var stored *database.SeriesPoint
+			if !rel.Resynthesize {
+				delay, _ := rel.delay()
+				var err error
+				if stored, err = g.db.FirstPointAfter(rel.Leader, startTime.Add(-delay).UnixMilli()-1); err != nil {
+					return nil, fmt.Errorf("failed to read leader %s: %w", rel.Leader, err)
+				}
+			}
+			if stored == nil || stored.Timestamp > endTime.UnixMilli() {
+				shadowed[rel.Leader] = true
+				shadowTags = append(shadowTags, rel.Leader)
+				pending = append(pending, rel.Leader)
+			}
+		}
+		shadowTags = orderForLags(shadowTags, opts.Lags)
+		if len(shadowTags) > 0 {
+			fmt.Printf("[GENERATE] Synthesizing lag leaders in memory: %s\n", strings.Join(shadowTags, ", "))
 		}
-		fmt.Printf("[GENERATE] Deleted all existing records (took %v)\n", time.Since(deleteStart).Round(time.Millisecond))
 	}
 
-	tx, err := conn.Begin()
+	// Resolve per-tag settings from stored profiles before touching any data
+	rawProfiles, err := g.db.ListTagProfiles()
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to load tag profiles: %w", err)
+	}
+	plans := make(map[string]tagPlan, len(tags))
+	planTags := append(append([]string(nil), tags...), shadowTags...)
+	for _, group := range opts.Groups {
+		// Group members are planned even when not generated, so the joint draw is the same in every run
+		planTags = append(planTags, group.Tags...)
+	}
+	for _, tag := range planTags {
+		if _, ok := plans[tag]; ok {
+			continue
+		}
+		profile, err := parseTagProfile(rawProfiles[tag])
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", tag, err)
+		}
+		plan, err := opts.planFor(tag, profile, func(source string) (*TagFit, error) { return loadTagFit(g.db, source) })
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", tag, err)
+		}
+		plans[tag] = plan
+	}
+	if len(rawProfiles) > 0 {
+		fmt.Printf("[GENERATE] Loaded %d tag profiles\n", len(rawProfiles))
 	}
-	defer tx.Rollback()
 
-	// Prepare statements
-	insertStmt, err := tx.Prepare(`
-		INSERT INTO insight_raws (tag, timestamp, value, quality)
-		VALUES (?, ?, ?, ?)
-	`)
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to prepare insert statement: %w", err)
+	seed := time.Now().UnixNano()
+	if opts.Seed != nil {
+		seed = *opts.Seed
 	}
-	defer insertStmt.Close()
 
-	checkStmt, err := tx.Prepare(`
-		SELECT quality FROM insight_raws
-		WHERE tag = ? AND timestamp = ?
-	`)
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to prepare check statement: %w", err)
+	// Correlated groups are drawn jointly up front; each member then replays its own series,
+	// centred in its value range with ±3σ spanning the range
+	groupModels := make(map[string]*seriesModel)
+	for i, group := range opts.Groups {
+		interval := plans[group.Tags[0]].interval
+		for _, t := range group.Tags[1:] {
+			if plans[t].interval != interval {
+				return nil, fmt.Errorf("groups[%d]: all tags must use the same interval (%s: %s, %s: %s)",
+					i, group.Tags[0], interval, t, plans[t].interval)
+			}
+		}
+		steps := int(endTime.Sub(startTime)/interval) + 1
+		process := correlatedProcess(group, steps, tagRand(seed, "group/"+strings.Join(group.Tags, ",")))
+		for j, t := range group.Tags {
+			p := plans[t]
+			groupModels[t] = &seriesModel{values: process[j], mid: (p.minValue + p.maxValue) / 2, sigma: (p.maxValue - p.minValue) / 6,
+				start: startTime, step: interval}
+		}
 	}
-	defer checkStmt.Close()
 
-	updateStmt, err := tx.Prepare(`
-		UPDATE insight_raws
-		SET value = ?, quality = ?
-		WHERE tag = ? AND timestamp = ?
-	`)
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to prepare update statement: %w", err)
+	// Followers read their leader's clean values, recorded while generating leaders in this run
+	// (or synthesizing them in memory). Otherwise, and for in-run leaders in modes other than
+	// replace, a leader's stored records are loaded from the database; they include the
+	// leader's anomalies, quality and sampling.
+	lagOf := make(map[string]LagRelation, len(opts.Lags))
+	isLeader := make(map[string]bool, len(opts.Lags))
+	for _, rel := range opts.Lags {
+		lagOf[rel.Tag] = rel
+		isLeader[rel.Leader] = true
+	}
+	inRun := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		inRun[t] = true
+	}
+	leaderValues := make(map[string][]database.SeriesPoint)
+	for _, rel := range opts.Lags {
+		if !inRun[rel.Tag] || shadowed[rel.Leader] || (inRun[rel.Leader] && mode == WriteReplace) {
+			continue
+		}
+		delay, _ := rel.delay()
+		pts, err := g.db.ReadSeries(rel.Leader, startTime.Add(-delay).UnixMilli(), endTime.UnixMilli())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read leader %s: %w", rel.Leader, err)
+		}
+		if len(pts) == 0 && !inRun[rel.Leader] {
+			return nil, fmt.Errorf("lag leader %s has no data in range (generate it first or include it in the run)", rel.Leader)
+		}
+		leaderValues[rel.Leader] = pts
 	}
-	defer updateStmt.Close()
 
-	totalRecords := 0
-	rand.Seed(time.Now().UnixNano())
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.OnStart != nil {
+		opts.OnStart(len(tags) + len(calcTags))
+	}
 
-	// Log generation start
-	fmt.Printf("[GENERATE] Starting generation for %d tags, interval: %d min, time range: %s to %s, value range: %.2f-%.2f\n",
-		len(tags), intervalMinutes, startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"), minValue, maxValue)
+	// Append modes continue each tag after its last stored record
+	lastPoints := make(map[string]*database.SeriesPoint)
+	if mode == WriteAppend || mode == WriteExtendToNow {
+		lastRecords, err := g.db.ListTagsLastRecordForTags(tags)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range lastRecords {
+			p, err := g.db.LastPointBefore(r.Tag, r.MaxTs+1)
+			if err != nil {
+				return nil, err
+			}
+			if p != nil {
+				lastPoints[r.Tag] = p
+			}
+		}
+	}
 
-	// Process each tag
+	// In replace mode each tag's stored records and events are deleted in the transaction
+	// of its new records, so a cancelled run keeps the tags it has not replaced yet
+	if mode != WriteReplace {
+		fmt.Printf("[GENERATE] Write mode %s: keeping existing records\n", mode)
+	}
+
+	// Records are upserted in multi-row statements and committed every generateCommitRows
+	// records and at the end of each tag; in replace mode only at the end of the tag, with
+	// the deletion of its stored records
+	writer := g.db.NewBatchWriter(opts.BatchSize, false)
+	defer writer.Close()
+	uncommitted := 0
+
+	totalRecords := 0
+	anomalyCount := 0
+	anomaliesCreatedAt := time.Now().UTC().Format(time.RFC3339)
+
+	// Plan each tag's run; an in-run leader starts from its stored values. Shadow runs of
+	// leaders outside the run come first, so they are picked up before their followers.
+	runs := make([]*tagRun, 0, len(tags))
+	runOf := make(map[string]*tagRun, len(tags)+len(shadowTags))
+	shadows := make([]*tagRun, 0, len(shadowTags))
+	for _, tag := range shadowTags {
+		plan := plans[tag]
+		run := &tagRun{
+			tag:     tag,
+			plan:    plan,
+			step:    plan.interval,
+			start:   startTime,
+			shadow:  true,
+			samples: make(chan []database.SeriesPoint),
+			done:    make(chan struct{}),
+		}
+		shadows = append(shadows, run)
+		runOf[tag] = run
+	}
 	for _, tag := range tags {
 		if tag == "" {
 			continue
 		}
-
-		tagStartTime := time.Now()
-		tagRecords := 0
-
-		// Initialize base value and current value for sequential generation
-		var baseValue float64
-		var currentValue float64
-		if useSequential {
-			// Random base value within configured range for this tag
-			baseValue = minValue + rand.Float64()*(maxValue-minValue)
-			currentValue = baseValue
-		}
-
-		// Generate records at the selected interval (e.g. every 1, 5, 15, 30, or 60 minutes)
-		for minute := 0; minute < totalMinutes; minute += intervalMinutes {
-			currentTime := startTime.Add(time.Duration(minute) * time.Minute)
-			timestamp := currentTime.UnixMilli()
-
-			// Generate value based on generation mode
-			var newValue float64
-			if useSequential {
-				// Sequential generation: change from previous value with 30% restriction
-				changePercent := (rand.Float64()*2 - 1) * 0.3 // -0.3 to 0.3
-				newValue = currentValue * (1 + changePercent)
-			} else {
-				// Completely random value within configured range [minValue, maxValue]
-				newValue = minValue + rand.Float64()*(maxValue-minValue)
+		plan := plans[tag]
+		run := &tagRun{
+			tag:     tag,
+			plan:    plan,
+			step:    plan.interval,
+			start:   startTime,
+			last:    lastPoints[tag],
+			samples: make(chan []database.SeriesPoint, generateChunkBuffer),
+			done:    make(chan struct{}),
+		}
+		if run.last != nil {
+			if next := time.UnixMilli(run.last.Timestamp).UTC().Add(run.step); next.After(run.start) {
+				run.start = next
 			}
+		}
+		if isLeader[tag] {
+			run.values = leaderValues[tag]
+		}
+		runs = append(runs, run)
+		runOf[tag] = run
+	}
 
-			// Clamp value to configured range [minValue, maxValue] (safety check)
-			wasClamped := false
-			originalValue := newValue
-			if newValue < minValue {
-				newValue = minValue
-				wasClamped = true
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = g.workers
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = max(min(workers, len(shadows)+len(runs)), 1)
+
+	// Log generation start
+	fmt.Printf("[GENERATE] Starting generation for %d tags, interval: %s, time range: %s to %s, value range: %.2f-%.2f, model: %s, seed: %d, mode: %s, workers: %d\n",
+		len(tags), interval, startTime.Format("2006-01-02 15:04:05"), endTime.Format("2006-01-02 15:04:05"), opts.MinValue, opts.MaxValue, normalizeSignalType(opts.Model.Type), seed, mode, workers)
+
+	// Workers synthesize tags concurrently, picking them up in order; values stream to this
+	// goroutine, the only writer, which stores the tags one after another in the same order.
+	// Stopping the workers on return releases any blocked on a full sample channel.
+	synth := &tagSynth{
+		db:           g.db,
+		opts:         opts,
+		seed:         seed,
+		mode:         mode,
+		loc:          loc,
+		startTime:    startTime,
+		endTime:      endTime,
+		groupModels:  groupModels,
+		lagOf:        lagOf,
+		isLeader:     isLeader,
+		runOf:        runOf,
+		leaderValues: leaderValues,
+	}
+	workCtx, stopWorkers := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer stopWorkers()
+	queue := make(chan *tagRun)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range queue {
+				synth.synthesize(workCtx, run)
 			}
-			if newValue > maxValue {
-				newValue = maxValue
-				wasClamped = true
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for _, run := range append(shadows, runs...) {
+			select {
+			case queue <- run:
+			case <-workCtx.Done():
+				return
 			}
-
-			quality := 3 // Fixed quality value
-
-			// Check if record exists
-			var existingQuality int
-			err = checkStmt.QueryRow(tag, timestamp).Scan(&existingQuality)
-
-			if err != nil {
-				// Record doesn't exist, insert new
-				if err == sql.ErrNoRows {
-					_, err = insertStmt.Exec(tag, timestamp, newValue, quality)
-					if err != nil {
-						return 0, 0, fmt.Errorf("failed to insert record for tag %s at %v: %w", tag, currentTime, err)
-					}
-					totalRecords++
-					tagRecords++
-				} else {
-					return 0, 0, fmt.Errorf("failed to check existing record: %w", err)
-				}
-			} else {
-				// Record exists, check quality
-				// Only update if new quality is higher or equal
-				if quality >= existingQuality {
-					_, err = updateStmt.Exec(newValue, quality, tag, timestamp)
-					if err != nil {
-						return 0, 0, fmt.Errorf("failed to update record: %w", err)
-					}
-					totalRecords++
-					tagRecords++
-
-					// Log every record generated
-					clampInfo := ""
-					if wasClamped {
-						clampInfo = fmt.Sprintf(" [CLAMPED: %.2f -> %.2f]", originalValue, newValue)
-					}
-					fmt.Printf("[GENERATE] UPDATE tag=%s timestamp=%s value=%.2f quality=%d%s\n",
-						tag, currentTime.Format("2006-01-02T15:04:05"), newValue, quality, clampInfo)
-				} else {
-					// Log skipped record (lower quality)
-					fmt.Printf("[GENERATE] SKIP tag=%s timestamp=%s (existing quality %d >= new quality %d)\n",
-						tag, currentTime.Format("2006-01-02T15:04:05"), existingQuality, quality)
-				}
+		}
+	}()
+
+	// cancelRun rolls back the tag being written: completed tags are committed; what was
+	// written of this one is removed, except in fill-gaps mode where new samples cannot be
+	// told apart from stored ones. In replace mode the rollback restores its stored records.
+	cancelRun := func(run *tagRun) error {
+		writer.Rollback()
+		if mode != WriteFillGaps && mode != WriteReplace {
+			if err := g.db.DeleteTagRecordsInRange(run.tag, run.start.UnixMilli(), endTime.UnixMilli()); err != nil {
+				return err
 			}
+		}
+		fmt.Printf("[GENERATE] Cancelled at tag %s, rolled back its records\n", run.tag)
+		return ctx.Err()
+	}
 
-			// Update current value for next iteration (only for sequential mode)
-			if useSequential {
-				currentValue = newValue
+	// Store each tag as its samples arrive
+	for _, run := range runs {
+		if ctx.Err() != nil {
+			return nil, cancelRun(run)
+		}
+		tagStartTime := time.Now()
+		writtenBefore := writer.Written()
+		if mode == WriteReplace {
+			if err := writer.Exec("DELETE FROM insight_raws WHERE tag = ?", run.tag); err != nil {
+				return nil, fmt.Errorf("failed to delete existing records for tag %s: %w", run.tag, err)
 			}
-
-			// Commit in batches to avoid memory issues
-			if totalRecords%10000 == 0 {
-				// Close old statements
-				insertStmt.Close()
-				checkStmt.Close()
-				updateStmt.Close()
-
-				if err := tx.Commit(); err != nil {
-					return 0, 0, fmt.Errorf("failed to commit batch: %w", err)
-				}
-				// Start new transaction
-				tx, err = conn.Begin()
-				if err != nil {
-					return 0, 0, fmt.Errorf("failed to begin new transaction: %w", err)
-				}
-				// Re-prepare statements for new transaction
-				insertStmt, err = tx.Prepare(`
-					INSERT INTO insight_raws (tag, timestamp, value, quality)
-					VALUES (?, ?, ?, ?)
-				`)
-				if err != nil {
-					return 0, 0, fmt.Errorf("failed to prepare insert statement: %w", err)
-				}
-				checkStmt, err = tx.Prepare(`
-					SELECT quality FROM insight_raws
-					WHERE tag = ? AND timestamp = ?
-				`)
-				if err != nil {
-					return 0, 0, fmt.Errorf("failed to prepare check statement: %w", err)
+			if err := writer.Exec("DELETE FROM anomalies WHERE tag = ?", run.tag); err != nil {
+				return nil, fmt.Errorf("failed to delete existing anomalies for tag %s: %w", run.tag, err)
+			}
+		}
+		for {
+			var chunk []database.SeriesPoint
+			var ok bool
+			select {
+			case chunk, ok = <-run.samples:
+			case <-ctx.Done():
+				return nil, cancelRun(run)
+			}
+			if !ok {
+				break
+			}
+			for _, p := range chunk {
+				if err := writer.Write(run.tag, p.Timestamp, p.Value, p.Quality); err != nil {
+					return nil, fmt.Errorf("tag %s: %w", run.tag, err)
 				}
-				updateStmt, err = tx.Prepare(`
-					UPDATE insight_raws
-					SET value = ?, quality = ?
-					WHERE tag = ? AND timestamp = ?
-				`)
-				if err != nil {
-					return 0, 0, fmt.Errorf("failed to prepare update statement: %w", err)
+			}
+			if uncommitted += len(chunk); uncommitted >= generateCommitRows && mode != WriteReplace {
+				if err := writer.Commit(); err != nil {
+					return nil, err
 				}
+				uncommitted = 0
 			}
 		}
+		if ctx.Err() != nil {
+			return nil, cancelRun(run)
+		}
+		if run.err != nil {
+			return nil, run.err
+		}
+
+		// A completed tag is always committed with its injected events (the ground truth
+		// labels), so cancelling later keeps it whole
+		if err := writer.Commit(); err != nil {
+			return nil, err
+		}
+		uncommitted = 0
+		tagRecords := writer.Written() - writtenBefore
+		totalRecords += tagRecords
+		if err := g.db.InsertAnomalies(run.anomalies, anomaliesCreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to record anomalies: %w", err)
+		}
+		anomalyCount += len(run.anomalies)
 
 		// Log completion for each tag
 		tagDuration := time.Since(tagStartTime)
-		fmt.Printf("[GENERATE] Completed tag: %s (%d records, took %v)\n", tag, tagRecords, tagDuration.Round(time.Millisecond))
+		fmt.Printf("[GENERATE] Completed tag: %s (%d records, took %v)\n", run.tag, tagRecords, tagDuration.Round(time.Millisecond))
 		if onTagComplete != nil {
-			onTagComplete(tag, tagRecords)
+			onTagComplete(run.tag, tagRecords)
+		}
+	}
+
+	// A full replace run also drops the records and events of tags it did not generate
+	if mode == WriteReplace && singleTag == "" && len(opts.Tags) == 0 {
+		if err := g.db.DeleteRecordsExcept(tags); err != nil {
+			return nil, fmt.Errorf("failed to delete existing records: %w", err)
 		}
 	}
 
-	// Final commit
-	if err := tx.Commit(); err != nil {
-		return 0, 0, fmt.Errorf("failed to commit final transaction: %w", err)
+	stats := writer.Stats()
+	fmt.Printf("[GENERATE] Wrote %s (batch size %d)\n", stats, writer.BatchSize())
+
+	if anomalyCount > 0 {
+		fmt.Printf("[GENERATE] Injected %d anomalies\n", anomalyCount)
 	}
 
+	// Materialize calculated tags from the freshly generated inputs
+	for _, tag := range calcTags {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		tagStartTime := time.Now()
+		n, err := g.materializeCalculated(tag, calcDefs[tag], startTime.UnixMilli(), endTime.UnixMilli())
+		if err != nil {
+			return nil, fmt.Errorf("failed to materialize calculated tag %s: %w", tag, err)
+		}
+		totalRecords += n
+		fmt.Printf("[GENERATE] Completed calculated tag: %s (%d records, took %v)\n", tag, n, time.Since(tagStartTime).Round(time.Millisecond))
+		if onTagComplete != nil {
+			onTagComplete(tag, n)
+		}
+	}
+	tagsCount := len(tags) + len(calcTags)
+
 	totalDuration := time.Since(generateStartTime)
 	fmt.Printf("[GENERATE] Generation completed: %d total records for %d tags (total time: %v)\n",
-		totalRecords, len(tags), totalDuration.Round(time.Second))
+		totalRecords, tagsCount, totalDuration.Round(time.Second))
+
+	return &GenerateResult{Records: totalRecords, Tags: tagsCount, Seed: seed, Write: stats}, nil
+}
+
+// Sample streaming between the synthesis workers and the writer
+const (
+	generateChunkSize   = 1000 // samples per chunk
+	generateChunkBuffer = 4    // chunks buffered per tag
+)
+
+// tagRun is one tag of a generation run. A worker streams its samples in chunks and
+// closes samples when done; err, anomalies and values are set before that.
+type tagRun struct {
+	tag       string
+	plan      tagPlan
+	step      time.Duration
+	start     time.Time             // first sample (after the last stored record in append modes)
+	last      *database.SeriesPoint // last stored record in append modes
+	samples   chan []database.SeriesPoint
+	done      chan struct{}          // closed when synthesis ends, for followers of this tag
+	values    []database.SeriesPoint // lag leader: its clean values (stored, then generated)
+	shadow    bool                   // lag leader outside the run: only its values are kept, nothing is stored
+	anomalies []database.AnomalyRow
+	err       error
+}
+
+// tagSynth is the run-wide state shared by the synthesis workers; it is read-only while they run
+type tagSynth struct {
+	db           *database.DB
+	opts         GenerateOptions
+	seed         int64
+	mode         string
+	loc          *time.Location
+	startTime    time.Time
+	endTime      time.Time
+	groupModels  map[string]*seriesModel
+	lagOf        map[string]LagRelation
+	isLeader     map[string]bool
+	runOf        map[string]*tagRun
+	leaderValues map[string][]database.SeriesPoint // leaders not in the run, read from the database
+}
+
+// synthesize generates the samples of one tag into run.samples
+func (s *tagSynth) synthesize(ctx context.Context, run *tagRun) {
+	err := s.synthesizeTag(ctx, run)
+	run.err = err
+	close(run.done)
+	close(run.samples)
+}
+
+func (s *tagSynth) synthesizeTag(ctx context.Context, run *tagRun) error {
+	tag, plan, step, tagStart, endTime := run.tag, run.plan, run.step, run.start, s.endTime
+
+	// Fresh model per tag so stateful models (walks) start independently
+	rng := tagRand(s.seed, tag)
+	var model SignalModel
+	if m, ok := s.groupModels[tag]; ok {
+		model = m
+	} else if rel, ok := s.lagOf[tag]; ok {
+		leader := s.leaderValues[rel.Leader]
+		if lr := s.runOf[rel.Leader]; lr != nil {
+			// Wait for the leader's values from this run
+			select {
+			case <-lr.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if lr.err != nil {
+				return fmt.Errorf("lag leader %s failed: %w", rel.Leader, lr.err)
+			}
+			leader = lr.values
+		}
+		model = newFollowerModel(rel, leader, rng)
+	} else if plan.fit != nil {
+		model = newFittedModel(plan.fit, rng)
+	} else {
+		var err error
+		model, err = NewSignalModel(plan.model, plan.minValue, plan.maxValue, rng)
+		if err != nil {
+			return fmt.Errorf("failed to build model for tag %s: %w", tag, err)
+		}
+	}
+	// Anomalies use their own source so clean values match a run without them
+	injector := planAnomalies(s.opts.Anomalies, tag, tagStart.UnixMilli(), endTime.UnixMilli(),
+		step, plan.minValue, plan.maxValue, s.loc, tagRand(s.seed, tag+"/anomalies"))
+	injector.faultCodes = plan.quality.faultCodes()
+	_, discrete := model.(*markovModel)
+	shaped := shapedModel(model)
+	season := newSeasonality(plan.seasonality, s.loc, s.startTime)
+	qualities := newQualityModel(plan.quality, step, tagRand(s.seed, tag+"/quality"))
+	isLeader := s.isLeader[tag]
+
+	// Stateful models continue from stored values (the clean value, before seasonality)
+	resumable, _ := model.(resumableModel)
+	resume := func(p database.SeriesPoint) {
+		if resumable == nil {
+			return
+		}
+		t := time.UnixMilli(p.Timestamp).UTC()
+		if !shaped {
+			resumable.Resume(t, p.Value)
+		} else {
+			resumable.Resume(t, season.remove(t, p.Value))
+		}
+	}
+	// Exception recording compares with the last stored sample, starting from the stored series
+	exceptions := newExceptionFilter(plan.sampling, plan.minValue, plan.maxValue)
+	if last := run.last; last != nil {
+		resume(*last)
+		exceptions.stored(last.Timestamp, last.Value, last.Quality)
+		fmt.Printf("[GENERATE] Tag %s continues after %s (value %.2f)\n", tag, time.UnixMilli(last.Timestamp).UTC().Format("2006-01-02T15:04:05"), last.Value)
+	}
+	var existing []database.SeriesPoint
+	halfStep := step.Milliseconds() / 2
+	if s.mode == WriteFillGaps {
+		var err error
+		existing, err = s.db.ReadSeries(tag, s.startTime.UnixMilli()-halfStep, endTime.UnixMilli()+halfStep)
+		if err != nil {
+			return err
+		}
+	}
+	nextExisting := 0
+
+	chunk := make([]database.SeriesPoint, 0, generateChunkSize)
+	send := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		select {
+		case run.samples <- chunk:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		chunk = make([]database.SeriesPoint, 0, generateChunkSize)
+		return nil
+	}
+
+	// Generate records at the tag's sample times (every interval, jittered or Poisson-distributed).
+	// Sample times have their own source so the grid does not shift the model's draws.
+	times := newSampler(plan.sampling, tagStart, endTime, step, tagRand(s.seed, tag+"/sampling"))
+	for currentTime, ok := times.next(); ok; currentTime, ok = times.next() {
+		timestamp := currentTime.UnixMilli()
+
+		// fill-gaps: a stored sample within half a step keeps its slot
+		for nextExisting < len(existing) && existing[nextExisting].Timestamp <= timestamp-halfStep {
+			nextExisting++
+		}
+		if nextExisting < len(existing) && existing[nextExisting].Timestamp < timestamp+halfStep {
+			p := existing[nextExisting]
+			resume(p)
+			exceptions.stored(p.Timestamp, p.Value, p.Quality)
+			continue
+		}
 
-	return totalRecords, len(tags), nil
+		// Generate value from the tag's signal model
+		newValue := model.Next(currentTime)
+		if fm, ok := model.(*fittedModel); ok && fm.missing() {
+			continue
+		}
+		if shaped {
+			newValue = season.apply(currentTime, newValue)
+			if plan.noise > 0 {
+				newValue += rng.NormFloat64() * plan.noise
+			}
+		}
+
+		// Clamp value to the tag's range [minValue, maxValue] (safety check); state codes are kept as is
+		if !discrete {
+			newValue = min(max(newValue, plan.minValue), plan.maxValue)
+		}
+
+		if isLeader {
+			run.values = append(run.values, database.SeriesPoint{Timestamp: timestamp, Value: newValue})
+		}
+		if run.shadow {
+			continue
+		}
+
+		quality := qualities.next(timestamp)
+
+		// Apply injected events (after clamping, so spikes may leave the normal range)
+		newValue, quality, keep := injector.apply(timestamp, newValue, quality)
+		if !keep || !exceptions.keep(timestamp, newValue, quality) {
+			continue
+		}
+		injector.stored(timestamp)
+
+		chunk = append(chunk, database.SeriesPoint{Timestamp: timestamp, Value: newValue, Quality: quality})
+		if len(chunk) == generateChunkSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		if err := send(); err != nil {
+			return err
+		}
+	}
+	run.anomalies = injector.rows(tag)
+
+	if isLeader && s.mode == WriteFillGaps {
+		// Generated samples were appended after the stored ones
+		pts := run.values
+		sort.Slice(pts, func(i, j int) bool { return pts[i].Timestamp < pts[j].Timestamp })
+	}
+	return nil
+}
+
+// materializeCalculated computes a calculated tag over [startTs, endTs] and stores the
+// result in insight_raws, replacing its previous records in that range.
+func (g *Generator) materializeCalculated(tag string, e *expr.Expr, startTs, endTs int64) (int, error) {
+	points, err := computeCalculated(g.db, e, startTs, endTs)
+	if err != nil {
+		return 0, err
+	}
+	if err := g.db.DeleteTagRecordsInRange(tag, startTs, endTs); err != nil {
+		return 0, err
+	}
+	writer := g.db.NewBatchWriter(0, true)
+	defer writer.Close()
+	for _, p := range points {
+		if err := writer.Write(tag, p.Timestamp, p.Value, p.Quality); err != nil {
+			return 0, err
+		}
+	}
+	if err := writer.Commit(); err != nil {
+		return 0, err
+	}
+	return len(points), nil
 }
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+func openTestDB(t *testing.T, tags ...string) *database.DB {
+	t.Helper()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, tag := range tags {
+		if err := db.InsertTagIfNotExists(tag, "", "", "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func generate(t *testing.T, db *database.DB, opts GenerateOptions) {
+	t.Helper()
+	if opts.StartTime == "" {
+		opts.StartTime, opts.EndTime = "2026-01-01T00:00:00", "2026-01-01T01:00:00"
+	}
+	opts.MinValue, opts.MaxValue = 0, 100
+	seed := int64(1)
+	opts.Seed = &seed
+	if _, err := NewGenerator(db).GenerateDummyData(context.Background(), opts, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countRecords(t *testing.T, db *database.DB, tag string) int {
+	t.Helper()
+	points, err := db.ReadSeries(tag, 0, 1<<62)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(points)
+}
+
+// writeSeries stores samples of tag, given as timestamp (ms), value and quality triples
+func writeSeries(t *testing.T, db *database.DB, tag string, samples ...float64) {
+	t.Helper()
+	writer := db.NewBatchWriter(0, true)
+	defer writer.Close()
+	for i := 0; i+2 < len(samples); i += 3 {
+		if err := writer.Write(tag, int64(samples[i]), samples[i+1], int(samples[i+2])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGenerateTagsReplaceKeepsOtherTags checks that a replace run filtered with Tags only
+// deletes the selected tags
+func TestGenerateTagsReplaceKeepsOtherTags(t *testing.T) {
+	db := openTestDB(t, "A", "B", "OTHER")
+	generate(t, db, GenerateOptions{})
+	before := countRecords(t, db, "OTHER")
+	if before == 0 {
+		t.Fatal("no records generated for OTHER")
+	}
+
+	generate(t, db, GenerateOptions{Tags: []string{"A", "B"}, StartTime: "2026-01-02T00:00:00", EndTime: "2026-01-02T01:00:00"})
+	if got := countRecords(t, db, "OTHER"); got != before {
+		t.Errorf("OTHER: %d records after a run for A, B; want %d", got, before)
+	}
+	// The selected tags are replaced: only the second range is left
+	if got := countRecords(t, db, "A"); got != 61 {
+		t.Errorf("A: %d records, want 61", got)
+	}
+}
+
+// TestGenerateFollowerAloneMatchesFullRun checks that a lag follower regenerated alone with
+// the run seed and resynthesize reproduces its values from the full run, although its
+// leader's stored records contain an anomaly
+func TestGenerateFollowerAloneMatchesFullRun(t *testing.T) {
+	db := openTestDB(t, "A", "C")
+	shift := 20.0
+	opts := GenerateOptions{
+		Lags: []LagRelation{{Tag: "C", Leader: "A", Delay: "5m", Resynthesize: true}},
+		Anomalies: []AnomalySpec{{Type: "level_shift", Tags: []string{"A"}, Magnitude: &shift,
+			Windows: []AnomalyWindow{{Start: "2026-01-01T00:10:00", End: "2026-01-01T00:40:00"}}}},
+	}
+	generate(t, db, opts)
+	full, err := db.ReadSeries("C", 0, 1<<62)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Tags = []string{"C"}
+	generate(t, db, opts)
+	alone, err := db.ReadSeries("C", 0, 1<<62)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alone) != len(full) {
+		t.Fatalf("C: %d records alone, %d in the full run", len(alone), len(full))
+	}
+	for i := range full {
+		if alone[i] != full[i] {
+			t.Errorf("C at %d: %v alone, %v in the full run", full[i].Timestamp, alone[i], full[i])
+		}
+	}
+}
+
+// TestGenerateFollowerOfStoredLeader checks that a follower regenerated alone follows the
+// stored records of its leader, e.g. imported ones
+func TestGenerateFollowerOfStoredLeader(t *testing.T) {
+	db := openTestDB(t, "A", "C")
+	var samples []float64
+	for ts := int64(1767225600000); ts <= 1767229200000; ts += 60000 {
+		samples = append(samples, float64(ts), 42, 3)
+	}
+	writeSeries(t, db, "A", samples...)
+
+	generate(t, db, GenerateOptions{Tags: []string{"C"}, Lags: []LagRelation{{Tag: "C", Leader: "A"}}})
+	points, err := db.ReadSeries("C", 0, 1<<62)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 61 {
+		t.Fatalf("C: %d records, want 61", len(points))
+	}
+	for _, p := range points {
+		if p.Value != 42 {
+			t.Fatalf("C at %d: %v, want the stored leader value 42", p.Timestamp, p.Value)
+		}
+	}
+}
+
+// TestGenerateAnomalyWindowInTimeZone checks that anomaly windows are local time in the
+// run's time zone, like the generation range
+func TestGenerateAnomalyWindowInTimeZone(t *testing.T) {
+	db := openTestDB(t, "A")
+	generate(t, db, GenerateOptions{
+		StartTime: "2026-01-01T07:00:00",
+		EndTime:   "2026-01-01T08:00:00",
+		TimeZone:  "Asia/Ho_Chi_Minh", // UTC+7
+		Anomalies: []AnomalySpec{{Type: "dropout",
+			Windows: []AnomalyWindow{{Start: "2026-01-01T07:10:00", End: "2026-01-01T07:19:00"}}}},
+	})
+	// 00:10-00:19 UTC is dropped: 61 samples minus 10
+	if got := countRecords(t, db, "A"); got != 51 {
+		t.Errorf("A: %d records, want 51", got)
+	}
+}
+
+// TestGenerateSpikeLabels checks that a spike is recorded only when a written sample carries it
+func TestGenerateSpikeLabels(t *testing.T) {
+	db := openTestDB(t, "A")
+	generate(t, db, GenerateOptions{
+		Anomalies: []AnomalySpec{
+			// Between two 1-minute samples
+			{Type: "spike", Windows: []AnomalyWindow{{Start: "2026-01-01T00:10:10", End: "2026-01-01T00:10:20"}}},
+			{Type: "spike", Windows: []AnomalyWindow{{Start: "2026-01-01T00:20:00", End: "2026-01-01T00:20:00"}}},
+			// On a dropped sample
+			{Type: "spike", Windows: []AnomalyWindow{{Start: "2026-01-01T00:30:00", End: "2026-01-01T00:30:00"}}},
+			{Type: "dropout", Windows: []AnomalyWindow{{Start: "2026-01-01T00:29:00", End: "2026-01-01T00:31:00"}}},
+		},
+	})
+	rows, err := db.ListAnomalies(nil, []string{AnomalySpike}, 0, 1<<62)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].StartTs != t0+20*60000 {
+		t.Errorf("spikes = %+v, want only the one at 00:20", rows)
+	}
+}
+
+// TestGenerateCounterMonotonic checks that a counter with noise and seasonality in its
+// profile only decreases where it wraps back to min
+func TestGenerateCounterMonotonic(t *testing.T) {
+	db := openTestDB(t, "FT")
+	rate, rollover, weekend := 600.0, 100.0, 0.5
+	daily := make([]float64, 24)
+	for h := range daily {
+		daily[h] = 1 + float64(h%5)/4
+	}
+	profile := `{"model":{"type":"counter","rate":` + fmt.Sprint(rate) + `,"rollover":` + fmt.Sprint(rollover) +
+		`},"noise":5,"seasonality":{"daily":` + strings.ReplaceAll(fmt.Sprint(daily), " ", ",") +
+		`,"weekend":` + fmt.Sprint(weekend) + `,"trend":3}}`
+	if _, err := db.SetTagProfile("FT", profile, "2026-01-01T00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	generate(t, db, GenerateOptions{StartTime: "2026-01-02T00:00:00", EndTime: "2026-01-04T00:00:00"})
+
+	points, err := db.ReadSeries("FT", 0, 1<<62)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) < 2 {
+		t.Fatalf("%d records generated", len(points))
+	}
+	wraps := 0
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1].Value, points[i].Value
+		if cur >= prev {
+			continue
+		}
+		// A rollover carries the increment over past min: at most a few mean increments
+		if inc := cur + rollover - prev; inc > 3*rate/60 {
+			t.Fatalf("counter decreased from %v to %v at %d", prev, cur, points[i].Timestamp)
+		}
+		wraps++
+	}
+	if wraps == 0 {
+		t.Error("counter never rolled over")
+	}
+}
+
+// TestGenerateReplaceCancelKeepsData checks that cancelling a replace run after its first
+// tag keeps the stored records and events of the tags not replaced yet
+func TestGenerateReplaceCancelKeepsData(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		tags []string
+	}{
+		{"all tags", nil},
+		{"selected tags", []string{"A", "B"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openTestDB(t, "A", "B", "OTHER")
+			shift := 10.0
+			generate(t, db, GenerateOptions{Anomalies: []AnomalySpec{{Type: "level_shift", Magnitude: &shift,
+				Windows: []AnomalyWindow{{Start: "2026-01-01T00:10:00", End: "2026-01-01T00:20:00"}}}}})
+			before := map[string]int{"B": countRecords(t, db, "B"), "OTHER": countRecords(t, db, "OTHER")}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			seed := int64(2)
+			opts := GenerateOptions{Tags: tc.tags, MinValue: 0, MaxValue: 100, Seed: &seed,
+				StartTime: "2026-01-02T00:00:00", EndTime: "2026-01-02T01:00:00"}
+			_, err := NewGenerator(db).GenerateDummyData(ctx, opts, func(tag string, records int) { cancel() })
+			if err != context.Canceled {
+				t.Fatalf("err = %v, want context.Canceled", err)
+			}
+
+			if got := countRecords(t, db, "A"); got != 61 {
+				t.Errorf("A: %d records, want the 61 of the second range", got)
+			}
+			for tag, want := range before {
+				if got := countRecords(t, db, tag); got != want {
+					t.Errorf("%s: %d records after cancelling, want %d", tag, got, want)
+				}
+				events, err := db.ListAnomalies([]string{tag}, nil, 0, 1<<62)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(events) != 1 {
+					t.Errorf("%s: %d anomalies after cancelling, want 1", tag, len(events))
+				}
+			}
+		})
+	}
+}
+
+// TestGenerateExtendToNow checks that extend-to-now continues a tag on its own step up to
+// the current time, not to the last full minute
+func TestGenerateExtendToNow(t *testing.T) {
+	db := openTestDB(t, "A")
+	if _, err := db.SetTagProfile("A", `{"interval":"10s"}`, "2026-01-01T00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	last := now.Truncate(10 * time.Second).Add(-5 * time.Minute)
+	writeSeries(t, db, "A", float64(last.UnixMilli()), 50, 3)
+
+	generate(t, db, GenerateOptions{Mode: WriteExtendToNow, StartTime: last.Add(-time.Hour).UTC().Format("2006-01-02T15:04:05")})
+	p, err := db.LastPointBefore("A", 1<<62)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := time.UnixMilli(p.Timestamp); got.Before(now.Add(-10*time.Second)) || (got.UnixMilli()-last.UnixMilli())%10000 != 0 {
+		t.Errorf("last sample at %s, want the last 10s step before now (%s)", got.UTC(), now.UTC())
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultInterval is the generation step when no frequency is given
+const DefaultInterval = time.Minute
+
+// MinInterval is the smallest generation step
+const MinInterval = time.Second
+
+// legacyFrequencies are the frequency names accepted before arbitrary durations
+var legacyFrequencies = map[string]time.Duration{
+	"1min":  time.Minute,
+	"5min":  5 * time.Minute,
+	"15min": 15 * time.Minute,
+	"30min": 30 * time.Minute,
+	"1hour": time.Hour,
+}
+
+var (
+	// dayDuration is a Go duration with a leading whole number of weeks or days, e.g. "1w", "1d" or "2d12h"
+	dayDuration = regexp.MustCompile(`^(\d+)([wd])(.*)$`)
+	// isoDuration is an ISO-8601 duration without years and months, e.g. "PT4H" or "P1DT30M"
+	isoDuration = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// ParseInterval parses a generation frequency: a Go duration ("10s", "2m30s"), a number
+// of weeks or days ("1w", "1d", "2d12h"), an ISO-8601 duration ("PT4H", "P1D") or one of the names
+// 1min, 5min, 15min, 30min and 1hour. An empty string is DefaultInterval. The result is
+// at least MinInterval.
+func ParseInterval(s string) (time.Duration, error) {
+	value := strings.TrimSpace(s)
+	if value == "" {
+		return DefaultInterval, nil
+	}
+	d, ok := legacyFrequencies[strings.ToLower(value)]
+	if !ok {
+		var err error
+		if d, err = parseDuration(value); err != nil {
+			return 0, fmt.Errorf("expected a duration like 10s, 5m, 2m30s, 1d or PT4H, got %q", s)
+		}
+	}
+	if d < MinInterval {
+		return 0, fmt.Errorf("must be at least %s, got %q", MinInterval, s)
+	}
+	return d, nil
+}
+
+// parseDuration parses a Go, day-suffixed or ISO-8601 duration
+func parseDuration(value string) (time.Duration, error) {
+	if m := isoDuration.FindStringSubmatch(strings.ToUpper(value)); m != nil && value != "P" && !strings.HasSuffix(strings.ToUpper(value), "T") {
+		var d time.Duration
+		units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+		for i, unit := range units {
+			if m[i+1] == "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(m[i+1], 64)
+			if err != nil {
+				return 0, err
+			}
+			d += time.Duration(n * float64(unit))
+		}
+		return d, nil
+	}
+	if m := dayDuration.FindStringSubmatch(value); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, err
+		}
+		d := time.Duration(days) * 24 * time.Hour
+		if m[2] == "w" {
+			d *= 7
+		}
+		if m[3] != "" {
+			rest, err := time.ParseDuration(m[3])
+			if err != nil {
+				return 0, err
+			}
+			d += rest
+		}
+		return d, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", DefaultInterval},
+		{"10s", 10 * time.Second},
+		{"2m30s", 150 * time.Second},
+		{"1d", 24 * time.Hour},
+		{"1w", 7 * 24 * time.Hour},
+		{"2d12h", 60 * time.Hour},
+		{"PT4H", 4 * time.Hour},
+		{"pt15m", 15 * time.Minute},
+		{"P1DT12H", 36 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"PT1.5S", 1500 * time.Millisecond},
+		{"5min", 5 * time.Minute},
+		{"1HOUR", time.Hour},
+		{" 1h ", time.Hour},
+	} {
+		got, err := ParseInterval(tc.in)
+		if err != nil {
+			t.Errorf("ParseInterval(%q): %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseInterval(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+	for _, in := range []string{"P", "PT", "P1M", "1x", "-5m", "500ms", "0s", "1d2", "fast"} {
+		if got, err := ParseInterval(in); err == nil {
+			t.Errorf("ParseInterval(%q) = %v, want an error", in, got)
+		}
+	}
+}
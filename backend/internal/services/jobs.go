@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned for an unknown job id
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobFinished is returned when cancelling a job that already finished
+var ErrJobFinished = errors.New("job already finished")
+
+// ErrJobQueueFull is returned when too many jobs are waiting to run
+var ErrJobQueueFull = errors.New("too many queued jobs")
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job event types (the NDJSON stream of POST /api/generate-dummy)
+const (
+	EventTagComplete = "tag_complete"
+	EventDone        = "done"
+	EventError       = "error"
+	EventCancelled   = "cancelled"
+)
+
+// maxFinishedJobs is how many finished jobs are kept for GET /api/jobs
+const maxFinishedJobs = 100
+
+// JobEvent is one entry of a job's event log
+type JobEvent struct {
+	Event      string  `json:"event"`
+	Tag        string  `json:"tag,omitempty"`
+	Records    int     `json:"records,omitempty"`
+	Count      int     `json:"count,omitempty"`
+	TagsCount  int     `json:"tags_count,omitempty"`
+	Seed       *int64  `json:"seed,omitempty"`
+	RowsPerSec float64 `json:"rows_per_sec,omitempty"` // Write throughput of the finished run
+	Message    string  `json:"message,omitempty"`
+}
+
+// Job is the API view of a generation job
+type Job struct {
+	ID         string  `json:"id"`
+	State      string  `json:"state"` // queued, running, completed, failed or cancelled
+	CreatedAt  string  `json:"created_at"`
+	StartedAt  string  `json:"started_at,omitempty"`
+	FinishedAt string  `json:"finished_at,omitempty"`
+	TagsTotal  int     `json:"tags_total"`
+	TagsDone   int     `json:"tags_done"`
+	Records    int     `json:"records"`
+	ETA        string  `json:"eta,omitempty"` // Estimated remaining time from the tags done so far
+	Seed       *int64  `json:"seed,omitempty"`
+	RowsPerSec float64 `json:"rows_per_sec,omitempty"` // Write throughput once completed
+	Error      string  `json:"error,omitempty"`
+}
+
+// job is a queued or running generation with its event log. changed is closed and
+// replaced whenever the job changes, to wake up event followers.
+type job struct {
+	seq     int
+	opts    GenerateOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	info    Job
+	started time.Time
+	events  []JobEvent
+	changed chan struct{}
+}
+
+// JobManager runs generation jobs in the background, one at a time in submission order
+type JobManager struct {
+	generator *Generator
+	mu        sync.Mutex
+	jobs      map[string]*job
+	nextID    int
+	queue     chan *job
+}
+
+// NewJobManager creates a JobManager and starts its worker
+func NewJobManager(generator *Generator) *JobManager {
+	m := &JobManager{generator: generator, jobs: make(map[string]*job), queue: make(chan *job, 1024)}
+	go m.work()
+	return m
+}
+
+// SubmitGenerate queues a GenerateDummyData run and returns its job
+func (m *JobManager) SubmitGenerate(opts GenerateOptions) (*Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.nextID++
+	j := &job{
+		seq:     m.nextID,
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+		changed: make(chan struct{}),
+		info: Job{
+			ID:        fmt.Sprintf("job-%d", m.nextID),
+			State:     JobQueued,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	m.jobs[j.info.ID] = j
+	m.pruneLocked()
+	m.mu.Unlock()
+	select {
+	case m.queue <- j:
+	default:
+		m.mu.Lock()
+		delete(m.jobs, j.info.ID)
+		m.mu.Unlock()
+		cancel()
+		return nil, ErrJobQueueFull
+	}
+	fmt.Printf("[JOBS] Queued %s\n", j.info.ID)
+	return j.snapshot(), nil
+}
+
+// List returns the known jobs ordered by submission
+func (m *JobManager) List() []Job {
+	m.mu.Lock()
+	jobs := make([]*job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j)
+	}
+	m.mu.Unlock()
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].seq < jobs[b].seq })
+	result := make([]Job, 0, len(jobs))
+	for _, j := range jobs {
+		result = append(result, *j.snapshot())
+	}
+	return result
+}
+
+// Get returns the status of a job
+func (m *JobManager) Get(id string) (*Job, error) {
+	j, err := m.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	return j.snapshot(), nil
+}
+
+// Cancel cancels a queued or running job. A running generation rolls back its open batch.
+func (m *JobManager) Cancel(id string) (*Job, error) {
+	j, err := m.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	j.mu.Lock()
+	state := j.info.State
+	if state == JobQueued {
+		j.info.State = JobCancelled
+		j.info.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		j.appendLocked(JobEvent{Event: EventCancelled, Message: "cancelled before start"})
+	}
+	j.mu.Unlock()
+	if state != JobQueued && state != JobRunning {
+		return nil, fmt.Errorf("%w: %s is %s", ErrJobFinished, id, state)
+	}
+	j.cancel()
+	fmt.Printf("[JOBS] Cancel requested for %s\n", id)
+	return j.snapshot(), nil
+}
+
+// Events returns the events of a job from index from on, a channel that is closed when
+// more are available, and whether the job has finished (no more events will follow)
+func (m *JobManager) Events(id string, from int) ([]JobEvent, <-chan struct{}, bool, error) {
+	j, err := m.lookup(id)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var events []JobEvent
+	if from < len(j.events) {
+		events = append(events, j.events[from:]...)
+	}
+	return events, j.changed, j.finishedLocked(), nil
+}
+
+func (m *JobManager) lookup(id string) (*job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return j, nil
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxFinishedJobs
+func (m *JobManager) pruneLocked() {
+	var finished []*job
+	for _, j := range m.jobs {
+		j.mu.Lock()
+		if j.finishedLocked() {
+			finished = append(finished, j)
+		}
+		j.mu.Unlock()
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].seq < finished[b].seq })
+	for _, j := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, j.info.ID)
+	}
+}
+
+// work runs the queued jobs one after another
+func (m *JobManager) work() {
+	for j := range m.queue {
+		m.run(j)
+	}
+}
+
+func (m *JobManager) run(j *job) {
+	j.mu.Lock()
+	if j.info.State != JobQueued {
+		j.mu.Unlock()
+		return // cancelled while queued
+	}
+	j.started = time.Now()
+	j.info.State = JobRunning
+	j.info.StartedAt = j.started.UTC().Format(time.RFC3339)
+	j.notifyLocked()
+	j.mu.Unlock()
+	fmt.Printf("[JOBS] Started %s\n", j.info.ID)
+
+	opts := j.opts
+	opts.OnStart = func(tags int) {
+		j.mu.Lock()
+		j.info.TagsTotal = tags
+		j.notifyLocked()
+		j.mu.Unlock()
+	}
+	onTagComplete := func(tag string, records int) {
+		j.mu.Lock()
+		j.info.TagsDone++
+		j.info.Records += records
+		if left := j.info.TagsTotal - j.info.TagsDone; left > 0 {
+			perTag := time.Since(j.started) / time.Duration(j.info.TagsDone)
+			j.info.ETA = (perTag * time.Duration(left)).Round(time.Second).String()
+		} else {
+			j.info.ETA = ""
+		}
+		j.appendLocked(JobEvent{Event: EventTagComplete, Tag: tag, Records: records})
+		j.mu.Unlock()
+	}
+	result, err := m.generator.GenerateDummyData(j.ctx, opts, onTagComplete)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.info.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	j.info.ETA = ""
+	switch {
+	case err == nil:
+		j.info.State = JobCompleted
+		j.info.Records = result.Records
+		j.info.Seed = &result.Seed
+		j.info.RowsPerSec = math.Round(result.Write.RowsPerSec())
+		j.appendLocked(JobEvent{Event: EventDone, Count: result.Records, TagsCount: result.Tags, Seed: &result.Seed, RowsPerSec: j.info.RowsPerSec})
+	case errors.Is(err, context.Canceled):
+		j.info.State = JobCancelled
+		j.appendLocked(JobEvent{Event: EventCancelled, Message: err.Error()})
+	default:
+		j.info.State = JobFailed
+		j.info.Error = err.Error()
+		j.appendLocked(JobEvent{Event: EventError, Message: err.Error()})
+	}
+	fmt.Printf("[JOBS] Finished %s: %s (%d records)\n", j.info.ID, j.info.State, j.info.Records)
+}
+
+func (j *job) snapshot() *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := j.info
+	return &info
+}
+
+func (j *job) finishedLocked() bool {
+	return j.info.State != JobQueued && j.info.State != JobRunning
+}
+
+func (j *job) appendLocked(ev JobEvent) {
+	j.events = append(j.events, ev)
+	j.notifyLocked()
+}
+
+func (j *job) notifyLocked() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+// ErrLiveNotFound is returned for an unknown live session id
+var ErrLiveNotFound = errors.New("live session not found")
+
+// ErrInvalidLiveOptions wraps validation failures of a live session request
+var ErrInvalidLiveOptions = errors.New("invalid live options")
+
+// ErrLiveConflict is returned when a tag is already fed by another live session
+var ErrLiveConflict = errors.New("tag already has a live session")
+
+// LiveOptions holds the parameters of a live session. Per-tag settings are resolved like
+// a GenerateDummyData run: tag model override, tag profile (or fit), then the defaults.
+type LiveOptions struct {
+	Tags        []string              // Optional: tags to feed (default: all non-calculated tags)
+	MinValue    float64               // Default value range
+	MaxValue    float64               // Default value range
+	Interval    time.Duration         // Default step between records (0 = DefaultInterval)
+	Model       SignalSpec            // Default signal model
+	TagModels   map[string]SignalSpec // Optional per-tag overrides of Model
+	Seed        *int64                // Optional: session seed. Nil picks one from the clock.
+	Quality     *QualitySpec          // Optional: quality code model
+	Seasonality *SeasonalitySpec      // Optional: calendar effects (a tag profile overrides it)
+	TimeZone    string                // Optional: IANA zone for seasonality (default UTC)
+}
+
+// LiveSession is the API view of a running live session
+type LiveSession struct {
+	ID        string   `json:"id"`
+	Tags      []string `json:"tags"`
+	Seed      int64    `json:"seed"`
+	StartedAt string   `json:"started_at"`
+	LastTick  string   `json:"last_tick,omitempty"` // Timestamp of the latest written sample
+	Records   int      `json:"records"`
+	Error     string   `json:"error,omitempty"` // Last write error, if any
+}
+
+// liveSession is a running session: its worker stops when stop is closed and closes done
+type liveSession struct {
+	seq  int // start order
+	mu   sync.Mutex
+	info LiveSession
+	stop chan struct{}
+	done chan struct{}
+}
+
+// liveStream generates the samples of one tag of a session
+type liveStream struct {
+	tag       string
+	plan      tagPlan
+	model     SignalModel
+	rng       *rand.Rand
+	discrete  bool
+	shaped    bool // seasonality and noise apply (see shapedModel)
+	season    *seasonality
+	qualities *qualityModel
+	interval  time.Duration
+	loc       *time.Location // zone of the wall-clock alignment
+	next      time.Time
+}
+
+// maxLiveCatchUp bounds the samples per tag written after a stall; older due samples are skipped
+const maxLiveCatchUp = 1000
+
+// LiveService runs background workers that append generated samples in real time
+type LiveService struct {
+	db       *database.DB
+	mu       sync.Mutex
+	sessions map[string]*liveSession
+	nextID   int
+}
+
+// NewLiveService creates a new LiveService instance
+func NewLiveService(db *database.DB) *LiveService {
+	return &LiveService{db: db, sessions: make(map[string]*liveSession)}
+}
+
+// Start validates opts and starts a session that writes one sample per tag every interval,
+// aligned to wall-clock time in opts.TimeZone (e.g. every full 5 minutes). Existing data is kept.
+func (s *LiveService) Start(opts LiveOptions) (*LiveSession, error) {
+	gen := GenerateOptions{
+		MinValue:    opts.MinValue,
+		MaxValue:    opts.MaxValue,
+		Interval:    opts.Interval,
+		Model:       opts.Model,
+		TagModels:   opts.TagModels,
+		Quality:     opts.Quality,
+		Seasonality: opts.Seasonality,
+	}
+	if err := gen.Model.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: model: %v", ErrInvalidLiveOptions, err)
+	}
+	for tag, spec := range gen.TagModels {
+		if err := spec.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: model for tag %s: %v", ErrInvalidLiveOptions, tag, err)
+		}
+	}
+	if gen.Quality != nil {
+		if err := gen.Quality.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: quality: %v", ErrInvalidLiveOptions, err)
+		}
+	}
+	if gen.Seasonality != nil {
+		if err := gen.Seasonality.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: seasonality: %v", ErrInvalidLiveOptions, err)
+		}
+	}
+	loc, err := LoadTimeZone(opts.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLiveOptions, err)
+	}
+
+	known, err := s.db.ListTagNamesFromTagsTable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags from DB: %w", err)
+	}
+	calcDefs, err := loadCalculatedDefs(s.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load calculated tags: %w", err)
+	}
+	tags := opts.Tags
+	if len(tags) == 0 {
+		for _, t := range known {
+			if calcDefs[t] == nil {
+				tags = append(tags, t)
+			}
+		}
+		if len(tags) == 0 {
+			return nil, fmt.Errorf("%w: no tags found in database (add tags via API first)", ErrInvalidLiveOptions)
+		}
+	} else {
+		isKnown := make(map[string]bool, len(known))
+		for _, t := range known {
+			isKnown[t] = true
+		}
+		seen := make(map[string]bool, len(tags))
+		for _, t := range tags {
+			if !isKnown[t] {
+				return nil, fmt.Errorf("%w: %s", ErrTagNotFound, t)
+			}
+			if calcDefs[t] != nil {
+				// Queries compute calculated tags from their inputs, so they follow the live inputs
+				return nil, fmt.Errorf("%w: %s is a calculated tag (feed its inputs instead)", ErrInvalidLiveOptions, t)
+			}
+			if seen[t] {
+				return nil, fmt.Errorf("%w: duplicate tag %s", ErrInvalidLiveOptions, t)
+			}
+			seen[t] = true
+		}
+	}
+
+	rawProfiles, err := s.db.ListTagProfiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tag profiles: %w", err)
+	}
+	seed := time.Now().UnixNano()
+	if opts.Seed != nil {
+		seed = *opts.Seed
+	}
+	now := time.Now().UTC()
+	streams := make([]*liveStream, 0, len(tags))
+	for _, tag := range tags {
+		profile, err := parseTagProfile(rawProfiles[tag])
+		if err != nil {
+			return nil, fmt.Errorf("%w: tag %s: %v", ErrInvalidLiveOptions, tag, err)
+		}
+		plan, err := gen.planFor(tag, profile, func(source string) (*TagFit, error) { return loadTagFit(s.db, source) })
+		if err != nil {
+			return nil, fmt.Errorf("%w: tag %s: %v", ErrInvalidLiveOptions, tag, err)
+		}
+		rng := tagRand(seed, tag)
+		var model SignalModel
+		if plan.fit != nil {
+			model = newFittedModel(plan.fit, rng)
+		} else if model, err = NewSignalModel(plan.model, plan.minValue, plan.maxValue, rng); err != nil {
+			return nil, fmt.Errorf("%w: tag %s: %v", ErrInvalidLiveOptions, tag, err)
+		}
+		_, discrete := model.(*markovModel)
+		interval := plan.interval
+		streams = append(streams, &liveStream{
+			tag:       tag,
+			plan:      plan,
+			model:     model,
+			rng:       rng,
+			discrete:  discrete,
+			shaped:    shapedModel(model),
+			season:    newSeasonality(plan.seasonality, loc, now),
+			qualities: newQualityModel(plan.quality, interval, tagRand(seed, tag+"/quality")),
+			interval:  interval,
+			loc:       loc,
+			next:      nextLiveTick(now, interval, loc),
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.sessions {
+		for _, t := range other.info.Tags {
+			for _, st := range streams {
+				if st.tag == t {
+					return nil, fmt.Errorf("%w: %s (session %s)", ErrLiveConflict, t, other.info.ID)
+				}
+			}
+		}
+	}
+	s.nextID++
+	sess := &liveSession{
+		seq: s.nextID,
+		info: LiveSession{
+			ID:        fmt.Sprintf("live-%d", s.nextID),
+			Tags:      append([]string(nil), tags...),
+			Seed:      seed,
+			StartedAt: now.Format(time.RFC3339),
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	s.sessions[sess.info.ID] = sess
+	go s.run(sess, streams)
+	fmt.Printf("[LIVE] Started session %s: %d tags, seed %d\n", sess.info.ID, len(tags), seed)
+	return sess.snapshot(), nil
+}
+
+// List returns the running sessions ordered by start
+func (s *LiveService) List() []LiveSession {
+	s.mu.Lock()
+	sessions := make([]*liveSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].seq < sessions[j].seq })
+	result := make([]LiveSession, 0, len(sessions))
+	for _, sess := range sessions {
+		result = append(result, *sess.snapshot())
+	}
+	return result
+}
+
+// Get returns a running session
+func (s *LiveService) Get(id string) (*LiveSession, error) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrLiveNotFound
+	}
+	return sess.snapshot(), nil
+}
+
+// Stop stops a session, waits for its worker to finish and returns its final state
+func (s *LiveService) Stop(id string) (*LiveSession, error) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	if ok {
+		delete(s.sessions, id)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrLiveNotFound
+	}
+	close(sess.stop)
+	<-sess.done
+	info := sess.snapshot()
+	fmt.Printf("[LIVE] Stopped session %s (%d records)\n", id, info.Records)
+	return info, nil
+}
+
+func (sess *liveSession) snapshot() *LiveSession {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	info := sess.info
+	info.Tags = append([]string(nil), sess.info.Tags...)
+	return &info
+}
+
+// run is the session worker: it sleeps until the next due sample, then writes every sample
+// that is due (catching up at most maxLiveCatchUp per tag after a stall) in one transaction
+func (s *LiveService) run(sess *liveSession, streams []*liveStream) {
+	defer close(sess.done)
+	for {
+		next := streams[0].next
+		for _, st := range streams[1:] {
+			if st.next.Before(next) {
+				next = st.next
+			}
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-sess.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		var rows []sampleRow
+		var lastTick int64
+		for _, st := range streams {
+			if now.Sub(st.next) > maxLiveCatchUp*st.interval {
+				st.next = nextLiveTick(now.Add(-maxLiveCatchUp*st.interval), st.interval, st.loc)
+			}
+			for !st.next.After(now) {
+				if row, ok := st.sample(st.next); ok {
+					rows = append(rows, row)
+					lastTick = max(lastTick, row.timestamp)
+				}
+				st.next = nextLiveTick(st.next, st.interval, st.loc)
+			}
+		}
+		err := writeSamples(s.db, rows)
+		sess.mu.Lock()
+		if err != nil {
+			sess.info.Error = err.Error()
+			fmt.Printf("[LIVE] Session %s: %v\n", sess.info.ID, err)
+		} else {
+			sess.info.Error = ""
+			sess.info.Records += len(rows)
+			if len(rows) > 0 {
+				sess.info.LastTick = time.UnixMilli(lastTick).UTC().Format("2006-01-02T15:04:05")
+			}
+		}
+		sess.mu.Unlock()
+	}
+}
+
+// nextLiveTick returns the first multiple of interval after t on the wall clock of loc,
+// counted from midnight (e.g. 10:05, 10:10 for 5 minutes, 00:00 local for a day)
+func nextLiveTick(t time.Time, interval time.Duration, loc *time.Location) time.Time {
+	_, offset := t.In(loc).Zone()
+	shift := time.Duration(offset) * time.Second
+	next := t.Add(shift).Truncate(interval).Add(interval).Add(-shift)
+	// Across a DST change the tick belongs to the wall clock of its own offset
+	if _, o := next.In(loc).Zone(); o != offset {
+		shift = time.Duration(o) * time.Second
+		if alt := t.Add(shift).Truncate(interval).Add(interval).Add(-shift); alt.After(t) {
+			next = alt
+		}
+	}
+	return next
+}
+
+// sampleRow is one sample written by a live or replay session
+type sampleRow struct {
+	tag       string
+	timestamp int64
+	value     float64
+	quality   int
+}
+
+// sample generates the value of the stream at t; ok is false inside a simulated gap
+func (st *liveStream) sample(t time.Time) (sampleRow, bool) {
+	value := st.model.Next(t)
+	if fm, ok := st.model.(*fittedModel); ok && fm.missing() {
+		return sampleRow{}, false
+	}
+	if st.shaped {
+		value = st.season.apply(t, value)
+		if st.plan.noise > 0 {
+			value += st.rng.NormFloat64() * st.plan.noise
+		}
+	}
+	if !st.discrete {
+		value = min(max(value, st.plan.minValue), st.plan.maxValue)
+	}
+	return sampleRow{tag: st.tag, timestamp: t.UnixMilli(), value: value, quality: st.qualities.next(t.UnixMilli())}, true
+}
+
+// writeSamples stores rows, replacing samples at the same timestamps
+func writeSamples(db *database.DB, rows []sampleRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	writer := db.NewBatchWriter(0, true)
+	defer writer.Close()
+	for _, r := range rows {
+		if err := writer.Write(r.tag, r.timestamp, r.value, r.quality); err != nil {
+			return err
+		}
+	}
+	if err := writer.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
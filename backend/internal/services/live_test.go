@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextLiveTick(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, tc := range []struct {
+		at       string
+		interval time.Duration
+		loc      *time.Location
+		want     string
+	}{
+		{"2026-01-01T10:03:20Z", 5 * time.Minute, time.UTC, "2026-01-01T10:05:00Z"},
+		{"2026-01-01T10:05:00Z", 5 * time.Minute, time.UTC, "2026-01-01T10:10:00Z"},
+		// Full hours and days of the local wall clock, not of UTC
+		{"2026-01-01T10:03:00Z", time.Hour, kolkata, "2026-01-01T10:30:00Z"},
+		{"2026-01-01T10:03:00Z", 24 * time.Hour, berlin, "2026-01-01T23:00:00Z"},
+		// Local midnight after the switch to summer time (UTC+2)
+		{"2026-03-28T23:00:00Z", 24 * time.Hour, berlin, "2026-03-29T22:00:00Z"},
+		{"2026-03-29T00:30:00Z", time.Hour, berlin, "2026-03-29T01:00:00Z"},
+	} {
+		at, _ := time.Parse(time.RFC3339, tc.at)
+		want, _ := time.Parse(time.RFC3339, tc.want)
+		if got := nextLiveTick(at, tc.interval, tc.loc); !got.Equal(want) {
+			t.Errorf("nextLiveTick(%s, %v, %s) = %s, want %s", tc.at, tc.interval, tc.loc, got.UTC().Format(time.RFC3339), tc.want)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -96,43 +95,10 @@ func (l *Loader) LoadFromReader(reader io.Reader) (int, error) {
 		return 0, fmt.Errorf("failed to decode JSON: %w", err)
 	}
 
-	conn := l.db.GetConn()
-	tx, err := conn.Begin()
-	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Prepare statements
-	insertStmt, err := tx.Prepare(`
-		INSERT INTO insight_raws (tag, timestamp, value, quality)
-		VALUES (?, ?, ?, ?)
-	`)
-	if err != nil {
-		return 0, fmt.Errorf("failed to prepare insert statement: %w", err)
-	}
-	defer insertStmt.Close()
-
-	checkStmt, err := tx.Prepare(`
-		SELECT quality FROM insight_raws
-		WHERE tag = ? AND timestamp = ?
-	`)
-	if err != nil {
-		return 0, fmt.Errorf("failed to prepare check statement: %w", err)
-	}
-	defer checkStmt.Close()
-
-	updateStmt, err := tx.Prepare(`
-		UPDATE insight_raws
-		SET value = ?, quality = ?
-		WHERE tag = ? AND timestamp = ?
-	`)
-	if err != nil {
-		return 0, fmt.Errorf("failed to prepare update statement: %w", err)
-	}
-	defer updateStmt.Close()
-
-	totalCount := 0
+	// Records are upserted in one transaction; an existing record is only replaced by one of
+	// higher or equal quality
+	writer := l.db.NewBatchWriter(0, false)
+	defer writer.Close()
 
 	for tag, dataPoints := range input.Result {
 		for _, dp := range dataPoints {
@@ -141,40 +107,16 @@ func (l *Loader) LoadFromReader(reader io.Reader) (int, error) {
 			if err != nil {
 				return 0, fmt.Errorf("invalid timestamp %s for tag %s: %w", dp.Timestamp, tag, err)
 			}
-
-			// Check if record exists
-			var existingQuality int
-			err = checkStmt.QueryRow(tag, timestamp).Scan(&existingQuality)
-
-			if err != nil {
-				// Record doesn't exist, insert new
-				if err == sql.ErrNoRows {
-					_, err = insertStmt.Exec(tag, timestamp, dp.Value, dp.Quality)
-					if err != nil {
-						return 0, fmt.Errorf("failed to insert record: %w", err)
-					}
-					totalCount++
-				} else {
-					return 0, fmt.Errorf("failed to check existing record: %w", err)
-				}
-			} else {
-				// Record exists, check quality
-				// Only update if new quality is higher or equal
-				if dp.Quality >= existingQuality {
-					_, err = updateStmt.Exec(dp.Value, dp.Quality, tag, timestamp)
-					if err != nil {
-						return 0, fmt.Errorf("failed to update record: %w", err)
-					}
-					totalCount++
-				}
-				// If new quality is lower, skip (don't update)
+			if err := writer.Write(tag, timestamp, dp.Value, dp.Quality); err != nil {
+				return 0, err
 			}
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	if err := writer.Commit(); err != nil {
+		return 0, err
 	}
+	totalCount := writer.Written()
 
 	now := time.Now().UTC().Format(time.RFC3339)
 	for tag := range input.Result {
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TagProfile is the per-tag generation profile stored in the tags table.
+// Fields left empty fall back to the generate request (or config) defaults.
+type TagProfile struct {
+	Model    *SignalSpec  `json:"model,omitempty"`    // Signal model for this tag
+	Min      *float64     `json:"min,omitempty"`      // Value range min
+	Max      *float64     `json:"max,omitempty"`      // Value range max
+	Interval string       `json:"interval,omitempty"` // Step between records, e.g. "5m", "10s", "1d" or "PT4H" (see ParseInterval)
+	Noise    float64      `json:"noise,omitempty"`    // Std dev of gaussian noise added to every sample (engineering units)
+	Unit     string       `json:"unit,omitempty"`     // Engineering unit (metadata only)
+	Quality  *QualitySpec `json:"quality,omitempty"`  // Quality code model for this tag
+	// Calendar effects (daily profile, weekend/holiday multipliers, trend) for this tag
+	Seasonality *SeasonalitySpec `json:"seasonality,omitempty"`
+	// Sample timing (sub-minute interval, jitter, poisson) and exception recording for this tag
+	Sampling *SamplingSpec `json:"sampling,omitempty"`
+	// State code -> label for discrete tags, e.g. {"0": "STOP", "1": "RUN", "2": "FAULT"}
+	States map[int]string `json:"states,omitempty"`
+}
+
+// Validate checks the profile fields.
+func (p *TagProfile) Validate() error {
+	if p.Model != nil {
+		if err := p.Model.Validate(); err != nil {
+			return fmt.Errorf("model: %w", err)
+		}
+	}
+	if p.Min != nil && p.Max != nil && *p.Min >= *p.Max {
+		return fmt.Errorf("min (%v) must be less than max (%v)", *p.Min, *p.Max)
+	}
+	if _, err := p.interval(); err != nil {
+		return err
+	}
+	if p.Noise < 0 {
+		return fmt.Errorf("noise must not be negative, got %v", p.Noise)
+	}
+	if p.Quality != nil {
+		if err := p.Quality.Validate(); err != nil {
+			return fmt.Errorf("quality: %w", err)
+		}
+	}
+	if p.Seasonality != nil {
+		if err := p.Seasonality.Validate(); err != nil {
+			return fmt.Errorf("seasonality: %w", err)
+		}
+	}
+	if p.Sampling != nil {
+		if err := p.Sampling.Validate(); err != nil {
+			return fmt.Errorf("sampling: %w", err)
+		}
+	}
+	return nil
+}
+
+// interval returns the profile interval (0 if not set).
+func (p *TagProfile) interval() (time.Duration, error) {
+	if strings.TrimSpace(p.Interval) == "" {
+		return 0, nil
+	}
+	d, err := ParseInterval(p.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("interval: %w", err)
+	}
+	return d, nil
+}
+
+// parseTagProfile decodes a stored profile (nil for an empty string).
+func parseTagProfile(raw string) (*TagProfile, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var p TagProfile
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return nil, fmt.Errorf("invalid stored profile: %w", err)
+	}
+	return &p, nil
+}
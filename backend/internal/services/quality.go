@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// defaultQuality is the quality code of a good sample (the historian's "good" code)
+const defaultQuality = 3
+
+// QualitySpec configures the quality codes written with generated samples.
+// An empty spec writes defaultQuality on every sample.
+type QualitySpec struct {
+	Weights       []QualityWeight `json:"weights,omitempty"`        // Weighted distribution of codes for normal samples
+	BurstRate     float64         `json:"burst_rate,omitempty"`     // Expected bad-quality bursts per day
+	BurstDuration string          `json:"burst_duration,omitempty"` // Mean burst length as a Go duration (exponentially distributed). Default 10m.
+	BurstCode     int             `json:"burst_code,omitempty"`     // Code written during bursts (default 0)
+	FaultCodes    map[string]int  `json:"fault_codes,omitempty"`    // Anomaly type -> code written while that injected fault is active
+}
+
+// QualityWeight is one entry of a weighted quality code distribution
+type QualityWeight struct {
+	Code   int     `json:"code"`
+	Weight float64 `json:"weight"`
+}
+
+// Validate checks weights, burst settings and fault code keys.
+func (s *QualitySpec) Validate() error {
+	total := 0.0
+	for _, w := range s.Weights {
+		if w.Weight < 0 {
+			return fmt.Errorf("weight of code %d must not be negative", w.Code)
+		}
+		total += w.Weight
+	}
+	if len(s.Weights) > 0 && total == 0 {
+		return fmt.Errorf("weights must not all be zero")
+	}
+	if s.BurstRate < 0 {
+		return fmt.Errorf("burst_rate must not be negative, got %v", s.BurstRate)
+	}
+	if _, err := s.burstDuration(); err != nil {
+		return err
+	}
+	for kind := range s.FaultCodes {
+		switch normalizeAnomalyType(kind) {
+		case AnomalySpike, AnomalyLevelShift, AnomalyDrift, AnomalyFlatline:
+		default:
+			return fmt.Errorf("fault_codes: unsupported anomaly type %q", kind)
+		}
+	}
+	return nil
+}
+
+func (s *QualitySpec) burstDuration() (time.Duration, error) {
+	if strings.TrimSpace(s.BurstDuration) == "" {
+		return 10 * time.Minute, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(s.BurstDuration))
+	if err != nil {
+		return 0, fmt.Errorf("invalid burst_duration %q: %w", s.BurstDuration, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("burst_duration must be positive, got %s", s.BurstDuration)
+	}
+	return d, nil
+}
+
+// faultCodes returns the fault code map with normalized anomaly type keys
+func (s *QualitySpec) faultCodes() map[string]int {
+	if s == nil || len(s.FaultCodes) == 0 {
+		return nil
+	}
+	codes := make(map[string]int, len(s.FaultCodes))
+	for kind, code := range s.FaultCodes {
+		codes[normalizeAnomalyType(kind)] = code
+	}
+	return codes
+}
+
+// qualityModel draws the quality code of each sample of one tag
+type qualityModel struct {
+	rng       *rand.Rand
+	codes     []int
+	cumWeight []float64
+	burstProb float64 // probability that a burst starts at a given sample
+	burstMean float64 // mean burst length in ms
+	burstCode int
+	burstEnd  int64 // end of the active burst (ms), 0 if none
+}
+
+// newQualityModel builds the quality model for a tag sampled every step. A nil spec
+// yields defaultQuality on every sample.
+func newQualityModel(spec *QualitySpec, step time.Duration, rng *rand.Rand) *qualityModel {
+	m := &qualityModel{rng: rng}
+	if spec == nil {
+		return m
+	}
+	total := 0.0
+	for _, w := range spec.Weights {
+		total += w.Weight
+		m.codes = append(m.codes, w.Code)
+		m.cumWeight = append(m.cumWeight, total)
+	}
+	if spec.BurstRate > 0 {
+		m.burstProb = spec.BurstRate * step.Hours() / 24
+		d, _ := spec.burstDuration()
+		m.burstMean = float64(d.Milliseconds())
+		m.burstCode = spec.BurstCode
+	}
+	return m
+}
+
+// next returns the quality code for the sample at ts (ms); samples must arrive in time order
+func (m *qualityModel) next(ts int64) int {
+	if m.burstEnd != 0 && ts <= m.burstEnd {
+		return m.burstCode
+	}
+	m.burstEnd = 0
+	if m.burstProb > 0 && m.rng.Float64() < m.burstProb {
+		m.burstEnd = ts + int64(m.rng.ExpFloat64()*m.burstMean)
+		return m.burstCode
+	}
+	if len(m.codes) == 0 {
+		return defaultQuality
+	}
+	r := m.rng.Float64() * m.cumWeight[len(m.cumWeight)-1]
+	for i, c := range m.cumWeight {
+		if r < c {
+			return m.codes[i]
+		}
+	}
+	return m.codes[len(m.codes)-1]
+}
@@ -1,15 +1,39 @@
 package services
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
 	"insightsim/internal/database"
+	"insightsim/internal/expr"
 	"insightsim/internal/models"
 )
 
+// Value functions selected with the agg query parameter
+const (
+	AggSum   = "sum"   // Sum of values per bucket (default)
+	AggDelta = "delta" // Counter increase, handling rollover and resets
+	AggRate  = "rate"  // Counter increase per second
+
+	AggTimeInState = "time_in_state" // Seconds spent in each state
+	AggTransitions = "transitions"   // Number of state changes
+	AggLastState   = "last_state"    // State at the end of the bucket
+)
+
+// IsPerTagAgg reports whether agg is evaluated in Go per tag rather than in SQL
+func IsPerTagAgg(agg string) bool {
+	switch agg {
+	case AggDelta, AggRate, AggTimeInState, AggTransitions, AggLastState, AggTWA, AggTotalize:
+		return true
+	}
+	return false
+}
+
+// ErrInvalidQuery wraps validation failures of query parameters
+var ErrInvalidQuery = errors.New("invalid query")
+
 // QueryService handles querying timeseries data from the database
 type QueryService struct {
 	db *database.DB
@@ -20,23 +44,53 @@ func NewQueryService(db *database.DB) *QueryService {
 	return &QueryService{db: db}
 }
 
-// QueryTimeseriesData queries data by date range, tags, and optional aggregation
-func (q *QueryService) QueryTimeseriesData(startTime, endTime string, tags []string, aggregate string) (*models.JSONOutput, error) {
+// QueryOptions holds the parameters of a QueryTimeseriesData call
+type QueryOptions struct {
+	Start     string        // Range start (ISO 8601; local time in TimeZone without an offset)
+	End       string        // Range end, inclusive (ISO 8601)
+	Tags      []string      // Optional: only these tags (default all)
+	Aggregate string        // Calendar bucket: raw (default), daily, weekly, monthly, quarterly or yearly
+	Interval  time.Duration // Optional: fixed-length buckets instead of a calendar bucket
+	Align     string        // Fixed bucket alignment: epoch (default), start, or an ISO 8601 origin timestamp
+	Aggs      []string      // Value functions (see ParseAggs). Default sum.
+	TimeZone  string        // Optional IANA zone of the calendar buckets; timestamps are then returned with their offset
+
+	TimeWeighting TimeWeighting // Interpolation and unit of agg twa and totalize
+
+	Resample ResampleOptions // Optional: values at the Interval grid points instead of buckets (no Aggs)
+}
+
+// QueryTimeseriesData queries data by date range, tags, and optional aggregation.
+// Aggs selects the value functions (see ParseAggs): one or more statistics per bucket
+// (sum by default), or a single delta/rate for counter tags,
+// time_in_state/transitions/last_state for discrete tags or time-weighted twa/totalize.
+// With Resample.Method set, every tag is instead resampled at the Interval grid points.
+func (q *QueryService) QueryTimeseriesData(opts QueryOptions) (*models.JSONOutput, error) {
 	queryStartTime := time.Now()
+	startTime, endTime, tags, aggs := opts.Start, opts.End, opts.Tags, opts.Aggs
+
+	loc, err := LoadTimeZone(opts.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
 
 	// Parse start and end timestamps
-	startTimestamp, err := parseTimestampToMillis(startTime)
+	startTimestamp, err := parseTimestampInLocation(startTime, loc)
 	if err != nil {
-		return nil, fmt.Errorf("invalid start time: %w", err)
+		return nil, fmt.Errorf("%w: invalid start time: %v", ErrInvalidQuery, err)
 	}
 
-	endTimestamp, err := parseTimestampToMillis(endTime)
+	endTimestamp, err := parseTimestampInLocation(endTime, loc)
 	if err != nil {
-		return nil, fmt.Errorf("invalid end time: %w", err)
+		return nil, fmt.Errorf("%w: invalid end time: %v", ErrInvalidQuery, err)
 	}
 
 	if startTimestamp > endTimestamp {
-		return nil, fmt.Errorf("start time must be before or equal to end time")
+		return nil, fmt.Errorf("%w: start time must be before or equal to end time", ErrInvalidQuery)
+	}
+	buckets, err := newBucketing(opts.Aggregate, opts.Interval, opts.Align, startTimestamp, endTimestamp, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
 	}
 
 	// Log query parameters
@@ -48,12 +102,131 @@ func (q *QueryService) QueryTimeseriesData(startTime, endTime string, tags []str
 			tagsInfo = fmt.Sprintf("%d tags (%s, ...)", len(tags), strings.Join(tags[:3], ", "))
 		}
 	}
-	fmt.Printf("[QUERY] Querying data: time range %s to %s, tags: %s, aggregate: %s\n", startTime, endTime, tagsInfo, aggregate)
+	resampling := opts.Resample.Method != ""
+	if resampling {
+		if len(aggs) > 0 {
+			return nil, fmt.Errorf("%w: agg cannot be combined with method (resampling)", ErrInvalidQuery)
+		}
+		if err := opts.Resample.validate(buckets, startTimestamp, endTimestamp); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+	}
+	if len(aggs) == 0 {
+		aggs = []string{AggSum}
+	}
+	if err := opts.TimeWeighting.validate(aggs[0]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	label := "agg: " + strings.Join(aggs, ",")
+	if resampling {
+		label = "resample: " + opts.Resample.Method
+	}
+	fmt.Printf("[QUERY] Querying data: time range %s to %s, tags: %s, aggregate: %s, %s\n", startTime, endTime, tagsInfo, buckets, label)
 
-	if aggregate == "" || aggregate == "raw" {
-		return q.queryRaw(q.db, startTimestamp, endTimestamp, tags, queryStartTime)
+	// Calculated tags requested explicitly are computed on the fly from their inputs
+	var calculated map[string]*expr.Expr
+	storedTags := tags
+	if len(tags) > 0 {
+		defs, err := loadCalculatedDefs(q.db)
+		if err != nil {
+			return nil, err
+		}
+		storedTags = nil
+		for _, tag := range tags {
+			if e, ok := defs[tag]; ok {
+				if calculated == nil {
+					calculated = make(map[string]*expr.Expr)
+				}
+				calculated[tag] = e
+			} else {
+				storedTags = append(storedTags, tag)
+			}
+		}
 	}
-	return q.queryAggregated(q.db, startTimestamp, endTimestamp, tags, aggregate, queryStartTime)
+
+	var eval seriesFunc
+	switch {
+	case resampling:
+		eval = func(_ *TagProfile, points []database.SeriesPoint, prev, next *database.SeriesPoint) []models.DataPoint {
+			return resample(points, prev, next, opts.Resample, buckets, startTimestamp, endTimestamp)
+		}
+	case IsPerTagAgg(aggs[0]):
+		eval = perTagAgg(aggs[0], opts.TimeWeighting, buckets, startTimestamp, endTimestamp)
+	}
+	if eval != nil {
+		output, err := q.queryPerTag(startTimestamp, endTimestamp, storedTags, calculated, label, eval, queryStartTime)
+		if err != nil {
+			return nil, err
+		}
+		if opts.TimeZone != "" {
+			localizeTimestamps(output.Result, loc)
+		}
+		return output, nil
+	}
+
+	output := &models.JSONOutput{Result: make(map[string][]models.DataPoint)}
+	if len(tags) == 0 || len(storedTags) > 0 {
+		var err error
+		if buckets.raw() {
+			output, err = q.queryRaw(q.db, startTimestamp, endTimestamp, storedTags, queryStartTime)
+		} else {
+			output, err = q.queryAggregated(q.db, startTimestamp, endTimestamp, storedTags, buckets, aggs, queryStartTime)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for tag, e := range calculated {
+		points, err := computeCalculated(q.db, e, startTimestamp, endTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute calculated tag %s: %w", tag, err)
+		}
+		if len(points) == 0 {
+			continue
+		}
+		if buckets.raw() {
+			output.Result[tag] = toDataPoints(points)
+		} else {
+			output.Result[tag] = aggregatePoints(points, buckets, aggs)
+		}
+		fmt.Printf("[QUERY] Computed calculated tag %s: %d points\n", tag, len(points))
+	}
+	if opts.TimeZone != "" {
+		localizeTimestamps(output.Result, loc)
+	}
+	return output, nil
+}
+
+// localizeTimestamps rewrites the UTC timestamps of result (formatTimestamp) as local
+// times in loc with their offset, e.g. 2024-03-10T00:00:00-05:00
+func localizeTimestamps(result map[string][]models.DataPoint, loc *time.Location) {
+	for _, points := range result {
+		for i := range points {
+			t, err := time.Parse(timestampLayout, points[i].Timestamp)
+			if err == nil {
+				points[i].Timestamp = t.In(loc).Format(time.RFC3339)
+			}
+		}
+	}
+}
+
+// toDataPoints converts stored samples to API data points
+func toDataPoints(points []database.SeriesPoint) []models.DataPoint {
+	result := make([]models.DataPoint, 0, len(points))
+	for _, p := range points {
+		result = append(result, models.DataPoint{Timestamp: formatTimestamp(p.Timestamp), Value: p.Value, Quality: p.Quality})
+	}
+	return result
+}
+
+// aggregatePoints buckets samples in Go the same way queryAggregated does in SQL: the aggs
+// statistics and MAX(quality) per bucket
+func aggregatePoints(points []database.SeriesPoint, buckets bucketing, aggs []string) []models.DataPoint {
+	stats := newStatBuckets(buckets, aggs)
+	for _, p := range points {
+		stats.add(p.Timestamp, p.Value, p.Quality)
+	}
+	return stats.result()
 }
 
 // queryRaw returns raw rows (no aggregation)
@@ -64,17 +237,7 @@ func (q *QueryService) queryRaw(conn *database.DB, startTimestamp, endTimestamp
 		WHERE timestamp >= ? AND timestamp <= ?
 	`
 	args := []interface{}{startTimestamp, endTimestamp}
-	if len(tags) > 0 {
-		query += " AND tag IN ("
-		for i, tag := range tags {
-			if i > 0 {
-				query += ","
-			}
-			query += "?"
-			args = append(args, tag)
-		}
-		query += ")"
-	}
+	query, args = appendTagFilter(query, args, tags)
 	query += " ORDER BY tag, timestamp"
 
 	rows, err := conn.GetConn().Query(query, args...)
@@ -108,33 +271,66 @@ func (q *QueryService) queryRaw(conn *database.DB, startTimestamp, endTimestamp
 	return &models.JSONOutput{Result: result}, nil
 }
 
-// queryAggregated runs GROUP BY with date bucket and SUM(value), MAX(quality)
-func (q *QueryService) queryAggregated(conn *database.DB, startTimestamp, endTimestamp int64, tags []string, aggregate string, queryStartTime time.Time) (*models.JSONOutput, error) {
-	// SQLite: bucket expression and ORDER BY bucket
-	// timestamp is stored in milliseconds
-	bucketExpr := bucketExpression(aggregate)
-	if bucketExpr == "" {
+// queryAggregated groups rows into buckets and returns the aggs statistics and MAX(quality)
+// per bucket. Statistics derived from SUM, COUNT, MIN and MAX are computed in SQL; first, last,
+// stddev and median need every sample, so the rows are streamed in time order and bucketed in Go.
+func (q *QueryService) queryAggregated(conn *database.DB, startTimestamp, endTimestamp int64, tags []string, buckets bucketing, aggs []string, queryStartTime time.Time) (*models.JSONOutput, error) {
+	if buckets.raw() {
 		return q.queryRaw(conn, startTimestamp, endTimestamp, tags, queryStartTime)
 	}
+	if needsSamples(aggs) {
+		return q.queryAggregatedSamples(conn, startTimestamp, endTimestamp, tags, buckets, aggs, queryStartTime)
+	}
 
 	query := fmt.Sprintf(`
-		SELECT tag, %s AS bucket, SUM(value) AS value, MAX(quality) AS quality
+		SELECT tag, %s AS bucket, SUM(value), COUNT(*), MIN(value), MAX(value), MAX(quality)
 		FROM insight_raws
 		WHERE timestamp >= ? AND timestamp <= ?
-	`, bucketExpr)
+	`, buckets.sqlExpr())
 	args := []interface{}{startTimestamp, endTimestamp}
-	if len(tags) > 0 {
-		query += " AND tag IN ("
-		for i, tag := range tags {
-			if i > 0 {
-				query += ","
-			}
-			query += "?"
-			args = append(args, tag)
+	query, args = appendTagFilter(query, args, tags)
+	query += " GROUP BY tag, bucket ORDER BY tag, bucket"
+
+	rows, err := conn.GetConn().Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query database: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string][]models.DataPoint)
+	for rows.Next() {
+		var tag string
+		var bucket int64 // Bucket start in milliseconds
+		var stats bucketStats
+		if err := rows.Scan(&tag, &bucket, &stats.sum, &stats.count, &stats.min, &stats.max, &stats.quality); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-		query += ")"
+		isoTime := formatTimestamp(buckets.fromSQL(bucket))
+		result[tag] = append(result[tag], statPoint(isoTime, &stats, aggs))
 	}
-	query += " GROUP BY tag, bucket ORDER BY tag, bucket"
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	totalRecords := 0
+	for _, dataPoints := range result {
+		totalRecords += len(dataPoints)
+	}
+	fmt.Printf("[QUERY] Query completed: %d records from %d tags (took %v)\n",
+		totalRecords, len(result), time.Since(queryStartTime).Round(time.Millisecond))
+	return &models.JSONOutput{Result: result}, nil
+}
+
+// queryAggregatedSamples is queryAggregated for statistics that need every sample
+func (q *QueryService) queryAggregatedSamples(conn *database.DB, startTimestamp, endTimestamp int64, tags []string, buckets bucketing, aggs []string, queryStartTime time.Time) (*models.JSONOutput, error) {
+	query := `
+		SELECT tag, timestamp, value, quality
+		FROM insight_raws
+		WHERE timestamp >= ? AND timestamp <= ?
+	`
+	args := []interface{}{startTimestamp, endTimestamp}
+	query, args = appendTagFilter(query, args, tags)
+	query += " ORDER BY tag, timestamp"
 
 	rows, err := conn.GetConn().Query(query, args...)
 	if err != nil {
@@ -143,19 +339,30 @@ func (q *QueryService) queryAggregated(conn *database.DB, startTimestamp, endTim
 	defer rows.Close()
 
 	result := make(map[string][]models.DataPoint)
+	var current string
+	var stats *statBuckets
 	for rows.Next() {
-		var tag, bucket string
+		var tag string
+		var timestamp int64
 		var value float64
 		var quality int
-		if err := rows.Scan(&tag, &bucket, &value, &quality); err != nil {
+		if err := rows.Scan(&tag, &timestamp, &value, &quality); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-		isoTime := bucketToISO(bucket, aggregate)
-		result[tag] = append(result[tag], models.DataPoint{Timestamp: isoTime, Value: value, Quality: quality})
+		if stats == nil || tag != current {
+			if stats != nil {
+				result[current] = stats.result()
+			}
+			current, stats = tag, newStatBuckets(buckets, aggs)
+		}
+		stats.add(timestamp, value, quality)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
+	if stats != nil {
+		result[current] = stats.result()
+	}
 
 	totalRecords := 0
 	for _, dataPoints := range result {
@@ -166,56 +373,33 @@ func (q *QueryService) queryAggregated(conn *database.DB, startTimestamp, endTim
 	return &models.JSONOutput{Result: result}, nil
 }
 
-// bucketExpression returns SQLite expression for grouping (empty = raw)
-func bucketExpression(aggregate string) string {
-	// datetime(timestamp/1000, 'unixepoch') is UTC in SQLite
-	dt := "datetime(timestamp/1000, 'unixepoch')"
-	switch aggregate {
-	case "daily":
-		return fmt.Sprintf("strftime('%%Y-%%m-%%d', %s)", dt)
-	case "monthly":
-		return fmt.Sprintf("strftime('%%Y-%%m', %s)", dt)
-	case "quarterly":
-		return fmt.Sprintf("strftime('%%Y', %s) || '-' || ((cast(strftime('%%m', %s) as integer) - 1) / 3 + 1)", dt, dt)
-	case "yearly":
-		return fmt.Sprintf("strftime('%%Y', %s)", dt)
-	default:
-		return ""
-	}
-}
-
-// bucketToISO converts SQL bucket string to ISO 8601 timestamp (bucket start)
-func bucketToISO(bucket, aggregate string) string {
-	switch aggregate {
-	case "daily":
-		// bucket e.g. "2026-01-29"
-		return bucket + "T00:00:00"
-	case "monthly":
-		// bucket e.g. "2026-01"
-		return bucket + "-01T00:00:00"
-	case "quarterly":
-		// bucket e.g. "2026-1", "2026-2", "2026-3", "2026-4"
-		parts := strings.SplitN(bucket, "-", 2)
-		if len(parts) != 2 {
-			return bucket + "T00:00:00"
-		}
-		year, _ := strconv.Atoi(parts[0])
-		q, _ := strconv.Atoi(parts[1])
-		if q < 1 || q > 4 {
-			return bucket + "T00:00:00"
-		}
-		month := (q-1)*3 + 1
-		return fmt.Sprintf("%04d-%02d-01T00:00:00", year, month)
-	case "yearly":
-		// bucket e.g. "2026"
-		return bucket + "-01-01T00:00:00"
-	default:
-		return bucket + "T00:00:00"
+// appendTagFilter restricts query to tags (no-op for an empty list)
+func appendTagFilter(query string, args []interface{}, tags []string) (string, []interface{}) {
+	if len(tags) == 0 {
+		return query, args
+	}
+	query += " AND tag IN ("
+	for i, tag := range tags {
+		if i > 0 {
+			query += ","
+		}
+		query += "?"
+		args = append(args, tag)
 	}
+	return query + ")", args
 }
 
 // parseTimestampToMillis converts ISO 8601 timestamp string to Unix milliseconds
 func parseTimestampToMillis(isoTime string) (int64, error) {
+	return parseTimestampInLocation(isoTime, time.UTC)
+}
+
+// parseTimestampInLocation is parseTimestampToMillis for timestamps without an offset
+// in loc (nil = UTC); a trailing Z or an explicit offset still wins
+func parseTimestampInLocation(isoTime string, loc *time.Location) (int64, error) {
+	if loc == nil || strings.HasSuffix(isoTime, "Z") {
+		loc = time.UTC
+	}
 	formats := []string{
 		"2006-01-02T15:04:05",
 		"2006-01-02T15:04:05Z",
@@ -229,7 +413,7 @@ func parseTimestampToMillis(isoTime string) (int64, error) {
 	}
 
 	for _, format := range formats {
-		t, err := time.Parse(format, isoTime)
+		t, err := time.ParseInLocation(format, isoTime, loc)
 		if err == nil {
 			return t.UnixMilli(), nil
 		}
@@ -238,8 +422,98 @@ func parseTimestampToMillis(isoTime string) (int64, error) {
 	return 0, fmt.Errorf("unable to parse timestamp: %s", isoTime)
 }
 
+// timestampLayout is the layout of formatTimestamp
+const timestampLayout = "2006-01-02T15:04:05"
+
 // formatTimestamp converts Unix milliseconds to ISO 8601 string (UTC)
 func formatTimestamp(millis int64) string {
 	t := time.UnixMilli(millis).UTC()
-	return t.Format("2006-01-02T15:04:05")
+	return t.Format(timestampLayout)
+}
+
+// seriesFunc evaluates one tag's series: its samples in the query range and the samples
+// just before and after the range (nil if none)
+type seriesFunc func(profile *TagProfile, points []database.SeriesPoint, prev, next *database.SeriesPoint) []models.DataPoint
+
+// perTagAgg returns the seriesFunc of an agg function evaluated in Go per tag
+func perTagAgg(agg string, tw TimeWeighting, buckets bucketing, startTs, endTs int64) seriesFunc {
+	return func(profile *TagProfile, points []database.SeriesPoint, prev, next *database.SeriesPoint) []models.DataPoint {
+		switch {
+		case agg == AggTWA || agg == AggTotalize:
+			return timeWeightedBuckets(points, prev, next, agg, tw.interpolation(profile), tw.Per, buckets, startTs, endTs)
+		case agg == AggDelta || agg == AggRate:
+			if buckets.raw() {
+				return counterPoints(points, prev, counterRangeOf(profile), agg)
+			}
+			return counterBuckets(points, prev, counterRangeOf(profile), agg, buckets, startTs, endTs)
+		default:
+			var labels map[int]string
+			if profile != nil {
+				labels = profile.States
+			}
+			return stateBuckets(points, prev, labels, agg, buckets, startTs, endTs)
+		}
+	}
+}
+
+// queryPerTag evaluates each tag's series in Go with eval (counter, state and
+// time-weighted aggregations, resampling), for stored and calculated tags; label names
+// the evaluation in logs
+func (q *QueryService) queryPerTag(startTs, endTs int64, storedTags []string, calculated map[string]*expr.Expr, label string, eval seriesFunc, queryStartTime time.Time) (*models.JSONOutput, error) {
+	if storedTags == nil && calculated == nil {
+		var err error
+		if storedTags, err = q.db.ListTagNames(); err != nil {
+			return nil, err
+		}
+	}
+	result := make(map[string][]models.DataPoint)
+	emit := func(tag string, points []database.SeriesPoint, prev, next *database.SeriesPoint) error {
+		raw, _, err := q.db.GetTagProfile(tag)
+		if err != nil {
+			return err
+		}
+		profile, err := parseTagProfile(raw)
+		if err != nil {
+			return fmt.Errorf("tag %s: %w", tag, err)
+		}
+		if out := eval(profile, points, prev, next); len(out) > 0 {
+			result[tag] = out
+		}
+		return nil
+	}
+	for _, tag := range storedTags {
+		points, err := q.db.ReadSeries(tag, startTs, endTs)
+		if err != nil {
+			return nil, err
+		}
+		prev, err := q.db.LastPointBefore(tag, startTs)
+		if err != nil {
+			return nil, err
+		}
+		// Interpolation up to endTs needs the next sample
+		next, err := q.db.FirstPointAfter(tag, endTs)
+		if err != nil {
+			return nil, err
+		}
+		if err := emit(tag, points, prev, next); err != nil {
+			return nil, err
+		}
+	}
+	for tag, e := range calculated {
+		points, err := computeCalculated(q.db, e, startTs, endTs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute calculated tag %s: %w", tag, err)
+		}
+		if err := emit(tag, points, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	totalRecords := 0
+	for _, dataPoints := range result {
+		totalRecords += len(dataPoints)
+	}
+	fmt.Printf("[QUERY] Query (%s) completed: %d records from %d tags (took %v)\n",
+		label, totalRecords, len(result), time.Since(queryStartTime).Round(time.Millisecond))
+	return &models.JSONOutput{Result: result}, nil
 }
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestQueryInvalidOptions checks that parameter errors wrap ErrInvalidQuery, so the
+// handler answers 400 rather than 500
+func TestQueryInvalidOptions(t *testing.T) {
+	q := NewQueryService(openTestDB(t, "A"))
+	for _, tc := range []struct {
+		name string
+		opts QueryOptions
+	}{
+		{"start", QueryOptions{Start: "yesterday", End: "2026-01-02T00:00:00"}},
+		{"end", QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-13-01T00:00:00"}},
+		{"range", QueryOptions{Start: "2026-01-02T00:00:00", End: "2026-01-01T00:00:00"}},
+		{"tz", QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-02T00:00:00", TimeZone: "Mars/Olympus"}},
+		{"aggregate and interval", QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-02T00:00:00", Aggregate: BucketDaily, Interval: time.Hour}},
+		{"align", QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-02T00:00:00", Interval: time.Hour, Align: "noon"}},
+		{"method without interval", QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-02T00:00:00", Resample: ResampleOptions{Method: ResampleLinear}}},
+		{"method and agg", QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-02T00:00:00", Interval: time.Hour,
+			Aggs: []string{AggSum}, Resample: ResampleOptions{Method: ResampleLinear}}},
+		{"interp", QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-02T00:00:00", Aggs: []string{AggTWA},
+			TimeWeighting: TimeWeighting{Interp: "cubic"}}},
+	} {
+		if _, err := q.QueryTimeseriesData(tc.opts); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: err = %v, want ErrInvalidQuery", tc.name, err)
+		}
+	}
+}
+
+// TestQueryStatistics checks the statistics computed in SQL (sum, count, min, max) and
+// from the samples (median, stddev, first, last) against the same buckets
+func TestQueryStatistics(t *testing.T) {
+	db := openTestDB(t, "A")
+	writeSeries(t, db, "A", t0, 4, 3, t0+600000, 1, 1, t0+1200000, 7, 3, t0+3600000, 2, 3)
+	q := NewQueryService(db)
+	for _, aggs := range [][]string{{AggSum, AggAvg, AggMin, AggMax, AggCount, AggRange}, {AggMedian, AggFirst, AggLast, AggStdDev}} {
+		out, err := q.QueryTimeseriesData(QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-01T01:59:59",
+			Tags: []string{"A"}, Interval: time.Hour, Aggs: aggs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := out.Result["A"]
+		if len(got) != 2 || got[0].Timestamp != "2026-01-01T00:00:00" || got[1].Timestamp != "2026-01-01T01:00:00" {
+			t.Fatalf("%v: %+v, want buckets at 00:00 and 01:00", aggs, got)
+		}
+		want := map[string]float64{AggSum: 12, AggAvg: 4, AggMin: 1, AggMax: 7, AggCount: 3, AggRange: 6,
+			AggMedian: 4, AggFirst: 4, AggLast: 7, AggStdDev: 3}
+		for _, agg := range aggs {
+			if v := got[0].Values[agg]; v != want[agg] {
+				t.Errorf("%s = %v, want %v", agg, v, want[agg])
+			}
+		}
+		if got[0].Quality != 3 {
+			t.Errorf("quality = %d, want the highest in the bucket (3)", got[0].Quality)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+// ErrReplayNotFound is returned for an unknown replay session id
+var ErrReplayNotFound = errors.New("replay session not found")
+
+// ErrInvalidReplayOptions wraps validation failures of a replay request
+var ErrInvalidReplayOptions = errors.New("invalid replay options")
+
+// ErrReplayConflict is returned when an output tag is already written by another replay
+var ErrReplayConflict = errors.New("tag already has a running replay")
+
+// Replay session states
+const (
+	ReplayRunning   = "running"
+	ReplayCompleted = "completed"
+	ReplayCancelled = "cancelled"
+)
+
+// replayTick is how often a replay worker writes the samples that became due
+const replayTick = time.Second
+
+// maxFinishedReplays is how many completed replays are kept for GET /api/replay
+const maxFinishedReplays = 100
+
+// ReplayOptions holds the parameters of a replay session
+type ReplayOptions struct {
+	Tags     []string `json:"tags"`               // Source tags
+	Start    string   `json:"start"`              // Source window start, 2006-01-02T15:04:05 in TimeZone
+	End      string   `json:"end"`                // Source window end (exclusive), 2006-01-02T15:04:05 in TimeZone
+	TimeZone string   `json:"timezone,omitempty"` // Optional: IANA zone of start/end (default UTC)
+	Speed    float64  `json:"speed,omitempty"`    // Optional: playback speed, 2 = twice as fast (default 1)
+	Loop     bool     `json:"loop,omitempty"`     // Optional: restart at the window start when it ends
+	Offset   string   `json:"offset,omitempty"`   // Optional: Go duration added to the output timestamps
+	Prefix   string   `json:"prefix,omitempty"`   // Optional: output tag = prefix + source tag (default: the source tag)
+}
+
+// ReplaySession is the API view of a replay session
+type ReplaySession struct {
+	ID        string   `json:"id"`
+	Tags      []string `json:"tags"`
+	Prefix    string   `json:"prefix,omitempty"`
+	Start     string   `json:"start"`
+	End       string   `json:"end"`
+	Speed     float64  `json:"speed"`
+	Loop      bool     `json:"loop"`
+	Offset    string   `json:"offset,omitempty"`
+	StartedAt string   `json:"started_at"`
+	State     string   `json:"state"`              // running, completed or cancelled
+	Position  string   `json:"position,omitempty"` // Source time replayed so far in the current cycle
+	Cycles    int      `json:"cycles"`             // Completed passes over the window
+	Records   int      `json:"records"`
+	Error     string   `json:"error,omitempty"` // Last read/write error, if any
+}
+
+// replaySession is a replay: its worker stops when stop is closed and closes done
+type replaySession struct {
+	seq  int // start order
+	mu   sync.Mutex
+	info ReplaySession
+	stop chan struct{}
+	done chan struct{}
+}
+
+// replayPlan maps source time to output time: source offset x (ms into the window) of
+// cycle c is written at started + offset + (c*length + x)/speed
+type replayPlan struct {
+	tags        []string
+	outputs     []string // output tag per source tag
+	windowStart int64    // ms
+	length      int64    // window length, ms
+	speed       float64
+	loop        bool
+	offset      time.Duration
+	started     time.Time
+}
+
+// ReplayService plays recorded history back as if it were happening now
+type ReplayService struct {
+	db       *database.DB
+	mu       sync.Mutex
+	sessions map[string]*replaySession
+	nextID   int
+}
+
+// NewReplayService creates a new ReplayService instance
+func NewReplayService(db *database.DB) *ReplayService {
+	return &ReplayService{db: db, sessions: make(map[string]*replaySession)}
+}
+
+// Start validates opts and starts replaying the window [start, end) of the source tags from now
+func (s *ReplayService) Start(opts ReplayOptions) (*ReplaySession, error) {
+	if len(opts.Tags) == 0 {
+		return nil, fmt.Errorf("%w: tags is required", ErrInvalidReplayOptions)
+	}
+	loc, err := LoadTimeZone(opts.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReplayOptions, err)
+	}
+	const timeFormat = "2006-01-02T15:04:05"
+	start, err := time.ParseInLocation(timeFormat, opts.Start, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid start '%s' (expected format: %s)", ErrInvalidReplayOptions, opts.Start, timeFormat)
+	}
+	end, err := time.ParseInLocation(timeFormat, opts.End, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid end '%s' (expected format: %s)", ErrInvalidReplayOptions, opts.End, timeFormat)
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: start must be before end", ErrInvalidReplayOptions)
+	}
+	if opts.Speed == 0 {
+		opts.Speed = 1
+	}
+	if opts.Speed < 0 || math.IsInf(opts.Speed, 0) || math.IsNaN(opts.Speed) {
+		return nil, fmt.Errorf("%w: speed must be positive", ErrInvalidReplayOptions)
+	}
+	var offset time.Duration
+	if opts.Offset != "" {
+		if offset, err = time.ParseDuration(opts.Offset); err != nil {
+			return nil, fmt.Errorf("%w: invalid offset %q", ErrInvalidReplayOptions, opts.Offset)
+		}
+	}
+	opts.Prefix = strings.TrimSpace(opts.Prefix)
+	now := time.Now()
+	if opts.Prefix == "" && now.Add(offset).Before(end) {
+		// Writing into the source tags must not overwrite the window while it is read
+		return nil, fmt.Errorf("%w: the window overlaps the replayed output (set a prefix or use an earlier window)", ErrInvalidReplayOptions)
+	}
+
+	known, err := s.db.ListTagNamesFromTagsTable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags from DB: %w", err)
+	}
+	calcDefs, err := loadCalculatedDefs(s.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load calculated tags: %w", err)
+	}
+	isKnown := make(map[string]bool, len(known))
+	for _, t := range known {
+		isKnown[t] = true
+	}
+	plan := replayPlan{
+		windowStart: start.UnixMilli(),
+		length:      end.Sub(start).Milliseconds(),
+		speed:       opts.Speed,
+		loop:        opts.Loop,
+		offset:      offset,
+		started:     now,
+	}
+	seen := make(map[string]bool, len(opts.Tags))
+	hasData := false
+	for _, t := range opts.Tags {
+		t = strings.TrimSpace(t)
+		if !isKnown[t] {
+			return nil, fmt.Errorf("%w: %s", ErrTagNotFound, t)
+		}
+		if calcDefs[t] != nil {
+			return nil, fmt.Errorf("%w: %s is a calculated tag (replay its inputs instead)", ErrInvalidReplayOptions, t)
+		}
+		if seen[t] {
+			return nil, fmt.Errorf("%w: duplicate tag %s", ErrInvalidReplayOptions, t)
+		}
+		seen[t] = true
+		last, err := s.db.LastPointBefore(t, end.UnixMilli())
+		if err != nil {
+			return nil, err
+		}
+		if last != nil && last.Timestamp >= start.UnixMilli() {
+			hasData = true
+		}
+		plan.tags = append(plan.tags, t)
+		plan.outputs = append(plan.outputs, opts.Prefix+t)
+	}
+	if !hasData {
+		return nil, fmt.Errorf("%w: no data for the source tags in the window", ErrInvalidReplayOptions)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.sessions {
+		if other.snapshot().State != ReplayRunning {
+			continue
+		}
+		for _, t := range other.info.Tags {
+			for _, out := range plan.outputs {
+				if other.info.Prefix+t == out {
+					return nil, fmt.Errorf("%w: %s (session %s)", ErrReplayConflict, out, other.info.ID)
+				}
+			}
+		}
+	}
+	if opts.Prefix != "" {
+		created := now.UTC().Format(time.RFC3339)
+		for _, out := range plan.outputs {
+			if err := s.db.InsertTagIfNotExists(out, created, created, "replay"); err != nil {
+				return nil, fmt.Errorf("failed to register tag %s: %w", out, err)
+			}
+		}
+	}
+	s.nextID++
+	sess := &replaySession{
+		seq: s.nextID,
+		info: ReplaySession{
+			ID:        fmt.Sprintf("replay-%d", s.nextID),
+			Tags:      plan.tags,
+			Prefix:    opts.Prefix,
+			Start:     opts.Start,
+			End:       opts.End,
+			Speed:     opts.Speed,
+			Loop:      opts.Loop,
+			Offset:    opts.Offset,
+			StartedAt: now.UTC().Format(time.RFC3339),
+			State:     ReplayRunning,
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	s.sessions[sess.info.ID] = sess
+	s.pruneLocked()
+	go s.run(sess, plan)
+	fmt.Printf("[REPLAY] Started session %s: %d tags, window %s to %s, speed %gx, loop %v\n",
+		sess.info.ID, len(plan.tags), opts.Start, opts.End, opts.Speed, opts.Loop)
+	return sess.snapshot(), nil
+}
+
+// List returns the replay sessions (running and finished) ordered by start
+func (s *ReplayService) List() []ReplaySession {
+	s.mu.Lock()
+	sessions := make([]*replaySession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].seq < sessions[j].seq })
+	result := make([]ReplaySession, 0, len(sessions))
+	for _, sess := range sessions {
+		result = append(result, *sess.snapshot())
+	}
+	return result
+}
+
+// Get returns the status of a replay session
+func (s *ReplayService) Get(id string) (*ReplaySession, error) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrReplayNotFound
+	}
+	return sess.snapshot(), nil
+}
+
+// Cancel stops a replay (if still running), removes it and returns its final state
+func (s *ReplayService) Cancel(id string) (*ReplaySession, error) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	if ok {
+		delete(s.sessions, id)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrReplayNotFound
+	}
+	close(sess.stop)
+	<-sess.done
+	sess.mu.Lock()
+	if sess.info.State == ReplayRunning {
+		sess.info.State = ReplayCancelled
+	}
+	sess.mu.Unlock()
+	info := sess.snapshot()
+	fmt.Printf("[REPLAY] Removed session %s (%s, %d records)\n", id, info.State, info.Records)
+	return info, nil
+}
+
+// pruneLocked drops the oldest completed replays beyond maxFinishedReplays
+func (s *ReplayService) pruneLocked() {
+	var finished []*replaySession
+	for _, sess := range s.sessions {
+		if sess.snapshot().State != ReplayRunning {
+			finished = append(finished, sess)
+		}
+	}
+	if len(finished) <= maxFinishedReplays {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].seq < finished[b].seq })
+	for _, sess := range finished[:len(finished)-maxFinishedReplays] {
+		delete(s.sessions, sess.info.ID)
+	}
+}
+
+func (sess *replaySession) snapshot() *ReplaySession {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	info := sess.info
+	info.Tags = append([]string(nil), sess.info.Tags...)
+	return &info
+}
+
+// run is the replay worker: every tick it writes the source samples that became due since
+// the previous tick. Failed ticks are retried on the next one.
+func (s *ReplayService) run(sess *replaySession, plan replayPlan) {
+	defer close(sess.done)
+	ticker := time.NewTicker(replayTick)
+	defer ticker.Stop()
+	var replayed int64 // source ms replayed so far, over all cycles
+	for {
+		select {
+		case <-sess.stop:
+			return
+		case <-ticker.C:
+		}
+
+		pos := int64(float64(time.Since(plan.started).Milliseconds()) * plan.speed)
+		finished := !plan.loop && pos >= plan.length
+		if finished {
+			pos = plan.length
+		}
+		rows, err := s.collect(plan, replayed, pos)
+		if err == nil {
+			err = writeSamples(s.db, rows)
+		}
+
+		sess.mu.Lock()
+		if err != nil {
+			sess.info.Error = err.Error()
+			fmt.Printf("[REPLAY] Session %s: %v\n", sess.info.ID, err)
+		} else {
+			replayed = pos
+			sess.info.Error = ""
+			sess.info.Records += len(rows)
+			sess.info.Cycles = int(pos / plan.length)
+			cyclePos := pos % plan.length
+			if finished {
+				cyclePos = plan.length
+			}
+			sess.info.Position = time.UnixMilli(plan.windowStart + cyclePos).UTC().Format("2006-01-02T15:04:05")
+			if finished {
+				sess.info.State = ReplayCompleted
+				fmt.Printf("[REPLAY] Session %s completed (%d records)\n", sess.info.ID, sess.info.Records)
+			}
+		}
+		sess.mu.Unlock()
+		if err == nil && finished {
+			return
+		}
+	}
+}
+
+// collect returns the output samples for the replayed source range [from, to) (ms over all cycles)
+func (s *ReplayService) collect(plan replayPlan, from, to int64) ([]sampleRow, error) {
+	var rows []sampleRow
+	base := plan.started.Add(plan.offset).UnixMilli()
+	for cycle := from / plan.length; cycle*plan.length < to; cycle++ {
+		cycleStart := cycle * plan.length
+		a := max(from, cycleStart) - cycleStart
+		b := min(to, cycleStart+plan.length) - cycleStart
+		if a >= b {
+			continue
+		}
+		for i, tag := range plan.tags {
+			points, err := s.db.ReadSeries(tag, plan.windowStart+a, plan.windowStart+b-1)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range points {
+				elapsed := float64(cycleStart+p.Timestamp-plan.windowStart) / plan.speed
+				rows = append(rows, sampleRow{
+					tag:       plan.outputs[i],
+					timestamp: base + int64(math.Round(elapsed)),
+					value:     p.Value,
+					quality:   p.Quality,
+				})
+			}
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestReplayPrune checks that only the newest completed replays are kept, and running ones always
+func TestReplayPrune(t *testing.T) {
+	s := NewReplayService(nil)
+	add := func(state string) {
+		s.nextID++
+		id := fmt.Sprintf("replay-%d", s.nextID)
+		s.sessions[id] = &replaySession{seq: s.nextID, info: ReplaySession{ID: id, State: state}}
+	}
+	add(ReplayRunning)
+	for range maxFinishedReplays + 5 {
+		add(ReplayCompleted)
+	}
+	s.pruneLocked()
+
+	if len(s.sessions) != maxFinishedReplays+1 {
+		t.Fatalf("%d sessions kept, want %d", len(s.sessions), maxFinishedReplays+1)
+	}
+	if _, err := s.Get("replay-1"); err != nil {
+		t.Errorf("running replay was dropped: %v", err)
+	}
+	for i := 2; i <= 6; i++ {
+		if _, err := s.Get(fmt.Sprintf("replay-%d", i)); err == nil {
+			t.Errorf("replay-%d was kept, want the oldest completed replays dropped", i)
+		}
+	}
+}
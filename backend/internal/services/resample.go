@@ -0,0 +1,142 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"insightsim/internal/database"
+	"insightsim/internal/models"
+)
+
+// Resample methods selected with the method query parameter: how the value at a grid
+// point is derived from the samples around it
+const (
+	ResamplePrevious = "previous" // Latest sample at or before the grid point
+	ResampleLinear   = "linear"   // Linear interpolation between the samples around the grid point
+	ResampleNearest  = "nearest"  // Closest sample (the earlier one on a tie)
+	ResampleNone     = "none"     // Only samples exactly at a grid point
+)
+
+// maxResamplePoints bounds the grid of a resample query (per tag)
+const maxResamplePoints = 1000000
+
+// ResampleOptions selects the resample mode of a query: values of every tag at the grid
+// points of the fixed interval (QueryOptions.Interval and Align)
+type ResampleOptions struct {
+	Method      string        // previous, linear, nearest or none; empty disables resampling
+	Limit       time.Duration // Max distance from a grid point to the samples its value is derived from (0 = unlimited)
+	Extrapolate time.Duration // How far beyond the first and last sample of a tag its value is extended (0 = not at all)
+}
+
+// validate checks the options against the grid
+func (r ResampleOptions) validate(grid bucketing, startTs, endTs int64) error {
+	switch r.Method {
+	case ResamplePrevious, ResampleLinear, ResampleNearest, ResampleNone:
+	default:
+		return fmt.Errorf("invalid method %q (expected previous, linear, nearest or none)", r.Method)
+	}
+	if grid.step <= 0 || grid.calendar != "" {
+		return fmt.Errorf("method requires an interval (the grid step)")
+	}
+	if r.Limit < 0 || r.Extrapolate < 0 {
+		return fmt.Errorf("limit and extrapolate must not be negative")
+	}
+	if (endTs-startTs)/grid.step >= maxResamplePoints {
+		return fmt.Errorf("resample grid too large: more than %d points per tag (use a larger interval or a shorter range)", maxResamplePoints)
+	}
+	return nil
+}
+
+// resample returns the values of a tag at the grid points within [startTs, endTs]. A
+// sample exactly at a grid point is returned as measured; other grid points are
+// interpolated with the method from the samples around them, which may lie outside the
+// range (prev and next, nil if none). Grid points before the first or after the last
+// sample are extrapolated with that sample's value up to r.Extrapolate away (forward
+// only for previous); grid points without a value are omitted.
+func resample(points []database.SeriesPoint, prev, next *database.SeriesPoint, r ResampleOptions, grid bucketing, startTs, endTs int64) []models.DataPoint {
+	series := make([]database.SeriesPoint, 0, len(points)+2)
+	if prev != nil {
+		series = append(series, *prev)
+	}
+	series = append(series, points...)
+	if next != nil {
+		series = append(series, *next)
+	}
+	if len(series) == 0 {
+		return nil
+	}
+	within := func(d int64, limit time.Duration) bool {
+		return limit == 0 || d <= limit.Milliseconds()
+	}
+	measured, interpolated := false, true
+
+	var result []models.DataPoint
+	t := grid.start(startTs).UnixMilli()
+	if t < startTs {
+		t += grid.step
+	}
+	i := -1 // Index of the latest sample at or before t
+	for ; t <= endTs; t += grid.step {
+		for i+1 < len(series) && series[i+1].Timestamp <= t {
+			i++
+		}
+		var p, q *database.SeriesPoint
+		if i >= 0 {
+			p = &series[i]
+		}
+		if i+1 < len(series) {
+			q = &series[i+1]
+		}
+
+		point := models.DataPoint{Timestamp: formatTimestamp(t), Interpolated: &interpolated}
+		switch {
+		case p != nil && p.Timestamp == t:
+			point.Value, point.Quality, point.Interpolated = p.Value, p.Quality, &measured
+		case r.Method == ResampleNone:
+			continue
+		case p == nil:
+			// Before the first sample
+			if r.Method == ResamplePrevious || r.Extrapolate == 0 || q.Timestamp-t > r.Extrapolate.Milliseconds() {
+				continue
+			}
+			point.Value, point.Quality = q.Value, q.Quality
+		case q == nil:
+			// After the last sample
+			if r.Extrapolate == 0 || t-p.Timestamp > r.Extrapolate.Milliseconds() {
+				continue
+			}
+			point.Value, point.Quality = p.Value, p.Quality
+		case r.Method == ResamplePrevious:
+			if !within(t-p.Timestamp, r.Limit) {
+				continue
+			}
+			point.Value, point.Quality = p.Value, p.Quality
+		case r.Method == ResampleNearest:
+			nearest := p
+			if q.Timestamp-t < t-p.Timestamp {
+				nearest = q
+			}
+			if !within(abs64(nearest.Timestamp-t), r.Limit) {
+				continue
+			}
+			point.Value, point.Quality = nearest.Value, nearest.Quality
+		default: // linear
+			if !within(t-p.Timestamp, r.Limit) || !within(q.Timestamp-t, r.Limit) {
+				continue
+			}
+			f := float64(t-p.Timestamp) / float64(q.Timestamp-p.Timestamp)
+			point.Value = p.Value + (q.Value-p.Value)*f
+			point.Quality = min(p.Quality, q.Quality)
+		}
+		result = append(result, point)
+	}
+	return result
+}
+
+// abs64 returns the absolute value of x
+func abs64(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+func TestResample(t *testing.T) {
+	const minute = 60000
+	sample := func(m int64, v float64) database.SeriesPoint {
+		return database.SeriesPoint{Timestamp: t0 + m*minute, Value: v, Quality: 3}
+	}
+	prev := sample(-5, 0)
+	points := []database.SeriesPoint{sample(10, 10), sample(25, 40)}
+	grid := bucketing{step: 10 * minute}
+
+	// want lists the grid points returned: minutes after t0, value and whether interpolated
+	type point struct {
+		m            int64
+		value        float64
+		interpolated bool
+	}
+	for _, tc := range []struct {
+		name   string
+		points []database.SeriesPoint
+		prev   *database.SeriesPoint
+		opts   ResampleOptions
+		want   []point
+	}{
+		{"previous", points, &prev, ResampleOptions{Method: ResamplePrevious},
+			[]point{{0, 0, true}, {10, 10, false}, {20, 10, true}}},
+		{"linear", points, &prev, ResampleOptions{Method: ResampleLinear},
+			[]point{{0, 10.0 / 3, true}, {10, 10, false}, {20, 30, true}}},
+		{"nearest", points, &prev, ResampleOptions{Method: ResampleNearest},
+			[]point{{0, 0, true}, {10, 10, false}, {20, 40, true}}},
+		{"none", points, &prev, ResampleOptions{Method: ResampleNone},
+			[]point{{10, 10, false}}},
+		// Grid points farther than limit from the samples used are omitted
+		{"previous with limit", points, &prev, ResampleOptions{Method: ResamplePrevious, Limit: 6 * time.Minute},
+			[]point{{0, 0, true}, {10, 10, false}}},
+		{"linear with limit", points, &prev, ResampleOptions{Method: ResampleLinear, Limit: 9 * time.Minute},
+			[]point{{10, 10, false}}},
+		{"nearest with limit", points, &prev, ResampleOptions{Method: ResampleNearest, Limit: 5 * time.Minute},
+			[]point{{0, 0, true}, {10, 10, false}, {20, 40, true}}},
+		// The last value extends up to extrapolate after the last sample
+		{"extrapolate forward", points, &prev, ResampleOptions{Method: ResamplePrevious, Extrapolate: 20 * time.Minute},
+			[]point{{0, 0, true}, {10, 10, false}, {20, 10, true}, {30, 40, true}, {40, 40, true}}},
+		// ... and, except for previous, the first value before the first sample
+		{"extrapolate backward", points, nil, ResampleOptions{Method: ResampleLinear, Extrapolate: 10 * time.Minute},
+			[]point{{0, 10, true}, {10, 10, false}, {20, 30, true}, {30, 40, true}}},
+		{"previous does not extrapolate backward", points, nil, ResampleOptions{Method: ResamplePrevious, Extrapolate: 10 * time.Minute},
+			[]point{{10, 10, false}, {20, 10, true}, {30, 40, true}}},
+		// On a tie the earlier sample is the nearest
+		{"nearest tie", []database.SeriesPoint{sample(15, 1), sample(25, 2)}, nil, ResampleOptions{Method: ResampleNearest},
+			[]point{{20, 1, true}}},
+		{"no samples", nil, nil, ResampleOptions{Method: ResampleLinear, Extrapolate: time.Hour}, nil},
+	} {
+		got := resample(tc.points, tc.prev, nil, tc.opts, grid, t0, t0+60*minute)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: %+v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i, p := range got {
+			w := tc.want[i]
+			if p.Timestamp != formatTimestamp(t0+w.m*minute) || math.Abs(p.Value-w.value) > 1e-9 ||
+				p.Interpolated == nil || *p.Interpolated != w.interpolated {
+				t.Errorf("%s: point %d = %+v (interpolated %v), want %v", tc.name, i, p, p.Interpolated != nil && *p.Interpolated, w)
+			}
+		}
+	}
+}
+
+// TestResampleNext checks interpolation toward the first sample after the range
+func TestResampleNext(t *testing.T) {
+	next := database.SeriesPoint{Timestamp: t0 + 3600000, Value: 100, Quality: 2}
+	points := []database.SeriesPoint{{Timestamp: t0, Value: 0, Quality: 3}}
+	got := resample(points, nil, &next, ResampleOptions{Method: ResampleLinear}, bucketing{step: 1800000}, t0, t0+1800000)
+	if len(got) != 2 || got[1].Value != 50 || got[1].Quality != 2 {
+		t.Errorf("%+v, want 50 with the lower quality 2 at 00:30", got)
+	}
+}
+
+func TestResampleValidate(t *testing.T) {
+	grid := bucketing{step: 60000}
+	for _, tc := range []struct {
+		name    string
+		opts    ResampleOptions
+		grid    bucketing
+		endTs   int64
+		wantErr bool
+	}{
+		{"valid", ResampleOptions{Method: ResampleLinear, Limit: time.Minute}, grid, t0 + 3600000, false},
+		{"method", ResampleOptions{Method: "spline"}, grid, t0 + 3600000, true},
+		{"no interval", ResampleOptions{Method: ResampleLinear}, bucketing{}, t0 + 3600000, true},
+		{"calendar", ResampleOptions{Method: ResampleLinear}, bucketing{calendar: BucketDaily}, t0 + 3600000, true},
+		{"negative limit", ResampleOptions{Method: ResampleLinear, Limit: -time.Minute}, grid, t0 + 3600000, true},
+		{"grid too large", ResampleOptions{Method: ResampleLinear}, bucketing{step: 1000}, t0 + maxResamplePoints*1000, true},
+	} {
+		if err := tc.opts.validate(tc.grid, t0, tc.endTs); (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Sampling modes
+const (
+	SamplingRegular = "regular" // one sample per interval, optionally offset and jittered (default)
+	SamplingPoisson = "poisson" // exponentially distributed gaps with the interval as mean
+)
+
+// SamplingSpec configures when samples are taken and which of them are recorded.
+// An empty spec samples exactly on the tag's interval grid and records every sample.
+type SamplingSpec struct {
+	Mode     string `json:"mode,omitempty"`     // regular (default) or poisson
+	Interval string `json:"interval,omitempty"` // Overrides the tag interval, down to 1s (e.g. "10s", see ParseInterval)
+	Offset   string `json:"offset,omitempty"`   // Regular: shift of the grid, e.g. "12s" for samples at :12
+	Jitter   string `json:"jitter,omitempty"`   // Regular: max random shift of each sample (less than half the interval)
+	// Exception recording: a sample is stored only when it differs from the last stored one
+	// by more than the deadband (or its quality changes)
+	Deadband        float64 `json:"deadband,omitempty"`         // Engineering units
+	DeadbandPercent float64 `json:"deadband_percent,omitempty"` // Percent of the tag's value range
+	MaxInterval     string  `json:"max_interval,omitempty"`     // Store at least once per max_interval even without an exception
+}
+
+// Validate checks the mode, durations and deadband.
+func (s *SamplingSpec) Validate() error {
+	mode := normalizeSamplingMode(s.Mode)
+	if mode != SamplingRegular && mode != SamplingPoisson {
+		return fmt.Errorf("unknown sampling mode %q (expected regular or poisson)", s.Mode)
+	}
+	interval, err := s.parseInterval()
+	if err != nil {
+		return err
+	}
+	offset, err := parseOptionalDuration("offset", s.Offset)
+	if err != nil {
+		return err
+	}
+	jitter, err := parseOptionalDuration("jitter", s.Jitter)
+	if err != nil {
+		return err
+	}
+	if mode == SamplingPoisson && (offset != 0 || jitter != 0) {
+		return fmt.Errorf("offset and jitter apply to regular sampling only")
+	}
+	if interval > 0 {
+		if offset >= interval {
+			return fmt.Errorf("offset (%s) must be less than the interval (%s)", s.Offset, s.Interval)
+		}
+		if 2*jitter >= interval {
+			return fmt.Errorf("jitter (%s) must be less than half the interval (%s)", s.Jitter, s.Interval)
+		}
+	}
+	if s.Deadband < 0 {
+		return fmt.Errorf("deadband must not be negative, got %v", s.Deadband)
+	}
+	if s.DeadbandPercent < 0 || s.DeadbandPercent > 100 {
+		return fmt.Errorf("deadband_percent must be in [0, 100], got %v", s.DeadbandPercent)
+	}
+	if _, err := parseOptionalDuration("max_interval", s.MaxInterval); err != nil {
+		return err
+	}
+	return nil
+}
+
+// interval returns the interval override (0 if not set)
+func (s *SamplingSpec) interval() time.Duration {
+	if s == nil {
+		return 0
+	}
+	d, _ := s.parseInterval()
+	return d
+}
+
+func (s *SamplingSpec) parseInterval() (time.Duration, error) {
+	if strings.TrimSpace(s.Interval) == "" {
+		return 0, nil
+	}
+	d, err := ParseInterval(s.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("interval: %w", err)
+	}
+	return d, nil
+}
+
+func normalizeSamplingMode(mode string) string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return SamplingRegular
+	}
+	return mode
+}
+
+// parseOptionalDuration parses a non-negative Go duration field ("" is 0)
+func parseOptionalDuration(field, value string) (time.Duration, error) {
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative, got %s", field, value)
+	}
+	return d, nil
+}
+
+// sampler yields the sample times of one tag within [start, end]
+type sampler struct {
+	mode   string
+	step   time.Duration
+	offset time.Duration
+	jitter time.Duration
+	rng    *rand.Rand
+	grid   time.Time // regular: current grid point; poisson: last sample time
+	start  time.Time
+	end    time.Time
+	first  bool
+}
+
+// newSampler builds the sampler of a tag sampled every step from start. A nil spec
+// yields the grid start, start+step, ...
+func newSampler(spec *SamplingSpec, start, end time.Time, step time.Duration, rng *rand.Rand) *sampler {
+	s := &sampler{mode: SamplingRegular, step: step, rng: rng, grid: start, start: start, end: end, first: true}
+	if spec != nil {
+		s.mode = normalizeSamplingMode(spec.Mode)
+		s.offset, _ = parseOptionalDuration("offset", spec.Offset)
+		s.jitter, _ = parseOptionalDuration("jitter", spec.Jitter)
+		// Keep jittered samples ordered when the tag interval is smaller than the spec assumed
+		s.jitter = min(s.jitter, (step-1)/2)
+		s.offset %= step
+	}
+	return s
+}
+
+// next returns the next sample time; ok is false past the end of the range
+func (s *sampler) next() (t time.Time, ok bool) {
+	if s.mode == SamplingPoisson {
+		if s.first {
+			s.first = false
+		} else {
+			gap := time.Duration(s.rng.ExpFloat64() * float64(s.step))
+			s.grid = s.grid.Add(max(gap.Truncate(time.Millisecond), time.Millisecond))
+		}
+		return s.grid, !s.grid.After(s.end)
+	}
+	if !s.first {
+		s.grid = s.grid.Add(s.step)
+	}
+	s.first = false
+	t = s.grid.Add(s.offset)
+	if s.jitter > 0 {
+		t = t.Add(time.Duration((2*s.rng.Float64() - 1) * float64(s.jitter)).Truncate(time.Millisecond))
+	}
+	if t.Before(s.start) {
+		t = s.start
+	}
+	return t, !t.After(s.end)
+}
+
+// exceptionFilter drops samples that stay within the deadband of the last stored one,
+// like a historian's exception reporting. The zero filter stores everything.
+type exceptionFilter struct {
+	deadband    float64
+	maxInterval int64 // ms, 0 = none
+	lastTs      int64
+	lastValue   float64
+	lastQuality int
+	has         bool
+}
+
+// newExceptionFilter builds the filter of a tag with value range [minValue, maxValue]
+func newExceptionFilter(spec *SamplingSpec, minValue, maxValue float64) *exceptionFilter {
+	f := &exceptionFilter{}
+	if spec == nil {
+		return f
+	}
+	f.deadband = math.Max(spec.Deadband, spec.DeadbandPercent/100*(maxValue-minValue))
+	maxInterval, _ := parseOptionalDuration("max_interval", spec.MaxInterval)
+	f.maxInterval = maxInterval.Milliseconds()
+	return f
+}
+
+// active reports whether the filter may drop samples
+func (f *exceptionFilter) active() bool {
+	return f.deadband > 0 || f.maxInterval > 0
+}
+
+// keep reports whether a sample is stored, and if so remembers it
+func (f *exceptionFilter) keep(ts int64, value float64, quality int) bool {
+	if f.active() && f.has && quality == f.lastQuality && math.Abs(value-f.lastValue) <= f.deadband &&
+		(f.maxInterval == 0 || ts-f.lastTs < f.maxInterval) {
+		return false
+	}
+	f.stored(ts, value, quality)
+	return true
+}
+
+// stored remembers a sample already in the database (the starting point of a continued series)
+func (f *exceptionFilter) stored(ts int64, value float64, quality int) {
+	f.lastTs, f.lastValue, f.lastQuality, f.has = ts, value, quality, true
+}
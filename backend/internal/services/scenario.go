@@ -0,0 +1,379 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+// ErrInvalidScenario is wrapped by every scenario validation failure
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// jsonIndex matches an array index segment of a JSON decoder field path
+var jsonIndex = regexp.MustCompile(`\.(\d+)`)
+
+// scenarioTimeFormat is the format of the scenario time range (as for generation start/end)
+const scenarioTimeFormat = "2006-01-02T15:04:05"
+
+// Scenario is a declarative multi-tag simulation: the tags to create with their profiles,
+// the relationships between them, injected events, time range and seed. Running it
+// creates missing tags, replaces their profiles and generates data for exactly these tags.
+type Scenario struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Start       string   `json:"start,omitempty"`     // 2006-01-02T15:04:05 in TimeZone (default: config range)
+	End         string   `json:"end,omitempty"`       // 2006-01-02T15:04:05 in TimeZone (default: config range)
+	TimeZone    string   `json:"timezone,omitempty"`  // IANA zone of start/end and seasonality (default: config)
+	Frequency   string   `json:"frequency,omitempty"` // Step between records for tags without a profile interval (see ParseInterval)
+	Seed        *int64   `json:"seed,omitempty"`      // Run seed; set it to reproduce the same data on every run
+	Mode        string   `json:"mode,omitempty"`      // Write mode: replace (default), append, fill-gaps or extend-to-now
+	MinValue    *float64 `json:"minValue,omitempty"`  // Value range of tags without a profile range (default: config)
+	MaxValue    *float64 `json:"maxValue,omitempty"`
+	// Signal model of tags without a profile model (default random)
+	Model       *SignalSpec        `json:"model,omitempty"`
+	Tags        []ScenarioTag      `json:"tags"`
+	Groups      []CorrelationGroup `json:"groups,omitempty"`
+	Lags        []LagRelation      `json:"lags,omitempty"`
+	Anomalies   []AnomalySpec      `json:"anomalies,omitempty"`
+	Quality     *QualitySpec       `json:"quality,omitempty"`
+	Seasonality *SeasonalitySpec   `json:"seasonality,omitempty"`
+	Sampling    *SamplingSpec      `json:"sampling,omitempty"`
+}
+
+// ScenarioTag is a tag of a scenario with its generation profile inline, e.g.
+// {"name": "FI101", "model": {"type": "sine"}, "min": 0, "max": 250, "unit": "m3/h"}
+type ScenarioTag struct {
+	Name string `json:"name"`
+	TagProfile
+}
+
+// FieldError is the validation failure of one scenario field
+type FieldError struct {
+	Field   string `json:"field"` // Path of the field, e.g. "tags[2].model" (empty for the whole file)
+	Message string `json:"message"`
+}
+
+// ScenarioError lists every invalid field of a scenario
+type ScenarioError struct {
+	Errors []FieldError
+}
+
+func (e *ScenarioError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Field == "" {
+			parts = append(parts, fe.Message)
+		} else {
+			parts = append(parts, fe.Field+": "+fe.Message)
+		}
+	}
+	return ErrInvalidScenario.Error() + ": " + strings.Join(parts, "; ")
+}
+
+func (e *ScenarioError) Unwrap() error {
+	return ErrInvalidScenario
+}
+
+// add records err for field (no-op for a nil err)
+func (e *ScenarioError) add(field string, err error) {
+	if err != nil {
+		e.Errors = append(e.Errors, FieldError{Field: field, Message: err.Error()})
+	}
+}
+
+// addf records a formatted message for field
+func (e *ScenarioError) addf(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// errOrNil returns e as an error if it has any field errors
+func (e *ScenarioError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// LoadScenario reads and validates a scenario file
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read scenario: %w", err)
+	}
+	return ParseScenario(data)
+}
+
+// ParseScenario decodes and validates a JSON scenario. Unknown fields are rejected so that
+// typos are not silently ignored. Invalid scenarios return a *ScenarioError.
+func ParseScenario(data []byte) (*Scenario, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var sc Scenario
+	if err := decoder.Decode(&sc); err != nil {
+		return nil, &ScenarioError{Errors: []FieldError{decodeFieldError(err)}}
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, &ScenarioError{Errors: []FieldError{{Message: "unexpected data after the scenario object"}}}
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// decodeFieldError maps a JSON decoding error to the field it concerns
+func decodeFieldError(err error) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		// The decoder writes array indexes as path segments (tags.5.model); use tags[5].model
+		return FieldError{Field: jsonIndex.ReplaceAllString(typeErr.Field, "[$1]"), Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	case errors.As(err, &syntaxErr):
+		return FieldError{Message: fmt.Sprintf("invalid JSON at offset %d: %v", syntaxErr.Offset, err)}
+	case errors.Is(err, io.EOF):
+		return FieldError{Message: "empty scenario"}
+	}
+	// e.g. json: unknown field "frequncy"
+	return FieldError{Message: strings.TrimPrefix(err.Error(), "json: ")}
+}
+
+// Validate checks every field and returns a *ScenarioError listing all invalid ones.
+func (sc *Scenario) Validate() error {
+	v := &ScenarioError{}
+	if strings.TrimSpace(sc.Name) == "" {
+		v.addf("name", "is required")
+	}
+	loc, err := LoadTimeZone(sc.TimeZone)
+	v.add("timezone", err)
+	if loc == nil {
+		loc = time.UTC
+	}
+	var start, end time.Time
+	if sc.Start != "" {
+		if start, err = time.ParseInLocation(scenarioTimeFormat, sc.Start, loc); err != nil {
+			v.addf("start", "invalid time %q (expected format: %s)", sc.Start, scenarioTimeFormat)
+		}
+	}
+	if sc.End != "" {
+		if end, err = time.ParseInLocation(scenarioTimeFormat, sc.End, loc); err != nil {
+			v.addf("end", "invalid time %q (expected format: %s)", sc.End, scenarioTimeFormat)
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		v.addf("end", "must be after start (%s)", sc.Start)
+	}
+	_, err = ParseInterval(sc.Frequency)
+	v.add("frequency", err)
+	mode, err := ParseWriteMode(sc.Mode)
+	v.add("mode", err)
+	if mode == WriteFillGaps && len(sc.Anomalies) > 0 {
+		v.addf("anomalies", "not supported with write mode %s", mode)
+	}
+	if sc.MinValue != nil && sc.MaxValue != nil && *sc.MinValue >= *sc.MaxValue {
+		v.addf("maxValue", "must be greater than minValue (%v)", *sc.MinValue)
+	}
+	if sc.Model != nil {
+		v.add("model", sc.Model.Validate())
+	}
+
+	declared := make(map[string]bool, len(sc.Tags))
+	if len(sc.Tags) == 0 {
+		v.addf("tags", "at least one tag is required")
+	}
+	for i := range sc.Tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		name := strings.TrimSpace(sc.Tags[i].Name)
+		switch {
+		case name == "":
+			v.addf(field+".name", "is required")
+		case declared[name]:
+			v.addf(field+".name", "duplicate tag %s", name)
+		default:
+			declared[name] = true
+		}
+		sc.Tags[i].validate(field, v)
+	}
+	checkDeclared := func(field string, tags []string) {
+		for _, t := range tags {
+			if !declared[t] {
+				v.addf(field, "tag %s is not declared in tags", t)
+			}
+		}
+	}
+
+	relationsValid := true
+	for i, g := range sc.Groups {
+		field := fmt.Sprintf("groups[%d]", i)
+		if err := g.Validate(); err != nil {
+			v.add(field, err)
+			relationsValid = false
+		}
+		checkDeclared(field+".tags", g.Tags)
+	}
+	for i, l := range sc.Lags {
+		field := fmt.Sprintf("lags[%d]", i)
+		if err := l.Validate(); err != nil {
+			v.add(field, err)
+			relationsValid = false
+		}
+		checkDeclared(field+".tag", []string{l.Tag})
+		checkDeclared(field+".leader", []string{l.Leader})
+	}
+	if relationsValid {
+		// Cross-relation checks (tag in two groups, lag cycles); the message names the entry
+		if err := ValidateRelations(sc.Groups, sc.Lags); err != nil {
+			field, message, _ := strings.Cut(err.Error(), ": ")
+			v.addf(field, "%s", message)
+		}
+	}
+	for i, a := range sc.Anomalies {
+		field := fmt.Sprintf("anomalies[%d]", i)
+		v.add(field, a.Validate())
+		checkDeclared(field+".tags", a.Tags)
+	}
+	if sc.Quality != nil {
+		v.add("quality", sc.Quality.Validate())
+	}
+	if sc.Seasonality != nil {
+		v.add("seasonality", sc.Seasonality.Validate())
+	}
+	if sc.Sampling != nil {
+		v.add("sampling", sc.Sampling.Validate())
+	}
+	return v.errOrNil()
+}
+
+// validate checks the profile fields of a scenario tag, reporting them under field
+func (t *ScenarioTag) validate(field string, v *ScenarioError) {
+	p := &t.TagProfile
+	if p.Model != nil {
+		v.add(field+".model", p.Model.Validate())
+	}
+	if p.Min != nil && p.Max != nil && *p.Min >= *p.Max {
+		v.addf(field+".max", "must be greater than min (%v)", *p.Min)
+	}
+	if strings.TrimSpace(p.Interval) != "" {
+		_, err := ParseInterval(p.Interval)
+		v.add(field+".interval", err)
+	}
+	if p.Noise < 0 {
+		v.addf(field+".noise", "must not be negative, got %v", p.Noise)
+	}
+	if p.Quality != nil {
+		v.add(field+".quality", p.Quality.Validate())
+	}
+	if p.Seasonality != nil {
+		v.add(field+".seasonality", p.Seasonality.Validate())
+	}
+	if p.Sampling != nil {
+		v.add(field+".sampling", p.Sampling.Validate())
+	}
+}
+
+// TagNames returns the names of the scenario's tags in declaration order
+func (sc *Scenario) TagNames() []string {
+	names := make([]string, len(sc.Tags))
+	for i, t := range sc.Tags {
+		names[i] = strings.TrimSpace(t.Name)
+	}
+	return names
+}
+
+// ScenarioService applies scenarios to the database
+type ScenarioService struct {
+	db *database.DB
+}
+
+// NewScenarioService creates a new ScenarioService
+func NewScenarioService(db *database.DB) *ScenarioService {
+	return &ScenarioService{db: db}
+}
+
+// Prepare creates the scenario's missing tags (source "scenario"), replaces their profiles
+// and returns the options of the scenario's generation run. defaults supplies the value
+// range, time range, time zone, model and seed for fields the scenario leaves empty.
+func (s *ScenarioService) Prepare(sc *Scenario, defaults GenerateOptions) (GenerateOptions, error) {
+	if err := sc.Validate(); err != nil {
+		return GenerateOptions{}, err
+	}
+	calcDefs, err := loadCalculatedDefs(s.db)
+	if err != nil {
+		return GenerateOptions{}, fmt.Errorf("failed to load calculated tags: %w", err)
+	}
+	v := &ScenarioError{}
+	for i, name := range sc.TagNames() {
+		if calcDefs[name] != nil {
+			v.addf(fmt.Sprintf("tags[%d].name", i), "%s is a calculated tag", name)
+		}
+	}
+	if err := v.errOrNil(); err != nil {
+		return GenerateOptions{}, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for i, name := range sc.TagNames() {
+		if err := s.db.InsertTagIfNotExists(name, now, now, "scenario"); err != nil {
+			return GenerateOptions{}, err
+		}
+		// A tag without profile fields gets its profile cleared, so earlier settings do not leak in
+		data, err := json.Marshal(sc.Tags[i].TagProfile)
+		if err != nil {
+			return GenerateOptions{}, fmt.Errorf("encode profile of %s: %w", name, err)
+		}
+		profile := string(data)
+		if profile == "{}" {
+			profile = ""
+		}
+		if _, err := s.db.SetTagProfile(name, profile, now); err != nil {
+			return GenerateOptions{}, err
+		}
+	}
+
+	interval, _ := ParseInterval(sc.Frequency)
+	opts := defaults
+	opts.Tag = ""
+	opts.Tags = sc.TagNames()
+	opts.TagModels = nil
+	opts.Interval = interval
+	opts.Groups = sc.Groups
+	opts.Lags = sc.Lags
+	opts.Anomalies = sc.Anomalies
+	opts.Quality = sc.Quality
+	opts.Seasonality = sc.Seasonality
+	opts.Sampling = sc.Sampling
+	opts.Mode = sc.Mode
+	if sc.Start != "" {
+		opts.StartTime = sc.Start
+	}
+	if sc.End != "" {
+		opts.EndTime = sc.End
+	}
+	if sc.TimeZone != "" {
+		opts.TimeZone = sc.TimeZone
+	}
+	if sc.MinValue != nil {
+		opts.MinValue = *sc.MinValue
+	}
+	if sc.MaxValue != nil {
+		opts.MaxValue = *sc.MaxValue
+	}
+	if opts.MinValue >= opts.MaxValue {
+		return GenerateOptions{}, &ScenarioError{Errors: []FieldError{{Field: "maxValue", Message: fmt.Sprintf("must be greater than minValue (%v)", opts.MinValue)}}}
+	}
+	if sc.Model != nil {
+		opts.Model = *sc.Model
+	}
+	if sc.Seed != nil {
+		opts.Seed = sc.Seed
+	}
+	return opts, nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// SeasonalitySpec holds composable calendar effects applied on top of a tag's signal model.
+// Multipliers are evaluated in the run's time zone; an empty spec leaves values unchanged.
+type SeasonalitySpec struct {
+	Daily         []float64 `json:"daily,omitempty"`          // 24 hourly multipliers (local hour 0..23), linearly interpolated
+	Weekend       *float64  `json:"weekend,omitempty"`        // Multiplier on Saturdays and Sundays
+	Holidays      []string  `json:"holidays,omitempty"`       // Local dates (2006-01-02) treated as holidays
+	HolidayFactor *float64  `json:"holiday_factor,omitempty"` // Multiplier on holidays (default: the weekend multiplier)
+	Trend         float64   `json:"trend,omitempty"`          // Added per day since the start of the run (engineering units)
+}
+
+// Validate checks the daily profile, multipliers and holiday dates.
+func (s *SeasonalitySpec) Validate() error {
+	if len(s.Daily) != 0 && len(s.Daily) != 24 {
+		return fmt.Errorf("daily must have 24 hourly values, got %d", len(s.Daily))
+	}
+	for i, f := range s.Daily {
+		if f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("daily[%d] must be a non-negative number", i)
+		}
+	}
+	if s.Weekend != nil && *s.Weekend < 0 {
+		return fmt.Errorf("weekend must not be negative, got %v", *s.Weekend)
+	}
+	if s.HolidayFactor != nil && *s.HolidayFactor < 0 {
+		return fmt.Errorf("holiday_factor must not be negative, got %v", *s.HolidayFactor)
+	}
+	if len(s.Holidays) > 0 && s.HolidayFactor == nil && s.Weekend == nil {
+		return fmt.Errorf("holidays need holiday_factor (or weekend)")
+	}
+	for _, d := range s.Holidays {
+		if _, err := time.Parse("2006-01-02", strings.TrimSpace(d)); err != nil {
+			return fmt.Errorf("invalid holiday %q (expected 2006-01-02)", d)
+		}
+	}
+	if math.IsNaN(s.Trend) || math.IsInf(s.Trend, 0) {
+		return fmt.Errorf("trend must be a finite number")
+	}
+	return nil
+}
+
+// LoadTimeZone resolves an IANA time zone name ("" = UTC)
+func LoadTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// seasonality applies a SeasonalitySpec to the samples of one tag
+type seasonality struct {
+	spec     *SeasonalitySpec
+	loc      *time.Location
+	start    time.Time
+	holidays map[string]bool
+}
+
+// newSeasonality returns nil for a nil spec (no effect)
+func newSeasonality(spec *SeasonalitySpec, loc *time.Location, start time.Time) *seasonality {
+	if spec == nil {
+		return nil
+	}
+	s := &seasonality{spec: spec, loc: loc, start: start, holidays: make(map[string]bool, len(spec.Holidays))}
+	for _, d := range spec.Holidays {
+		s.holidays[strings.TrimSpace(d)] = true
+	}
+	return s
+}
+
+// apply returns value scaled by the calendar multipliers at t, plus the trend
+func (s *seasonality) apply(t time.Time, value float64) float64 {
+	if s == nil {
+		return value
+	}
+	return value*s.factor(t) + s.trend(t)
+}
+
+// remove inverts apply: it returns the clean value that apply maps to value at t
+func (s *seasonality) remove(t time.Time, value float64) float64 {
+	if s == nil {
+		return value
+	}
+	value -= s.trend(t)
+	if f := s.factor(t); f != 0 {
+		value /= f
+	}
+	return value
+}
+
+// factor returns the product of the calendar multipliers at t
+func (s *seasonality) factor(t time.Time) float64 {
+	local := t.In(s.loc)
+	factor := 1.0
+	if len(s.spec.Daily) == 24 {
+		h := float64(local.Hour()) + float64(local.Minute())/60 + float64(local.Second())/3600
+		i := int(h)
+		frac := h - float64(i)
+		factor *= s.spec.Daily[i]*(1-frac) + s.spec.Daily[(i+1)%24]*frac
+	}
+	switch {
+	case s.holidays[local.Format("2006-01-02")]:
+		if s.spec.HolidayFactor != nil {
+			factor *= *s.spec.HolidayFactor
+		} else {
+			factor *= *s.spec.Weekend
+		}
+	case s.spec.Weekend != nil && (local.Weekday() == time.Saturday || local.Weekday() == time.Sunday):
+		factor *= *s.spec.Weekend
+	}
+	return factor
+}
+
+// trend returns the linear trend at t (per day since the start of the run)
+func (s *seasonality) trend(t time.Time) float64 {
+	return s.spec.Trend * t.Sub(s.start).Hours() / 24
+}
@@ -0,0 +1,532 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Signal model types accepted in SignalSpec.Type
+const (
+	SignalRandom     = "random"
+	SignalSequential = "sequential"
+	SignalSine       = "sine"
+	SignalSawtooth   = "sawtooth"
+	SignalSquare     = "square"
+	SignalRandomWalk = "random_walk"
+	SignalConstant   = "constant"
+	SignalCounter    = "counter"
+	SignalBoolean    = "boolean"
+	SignalEnum       = "enum"
+	SignalFitted     = "fitted"
+)
+
+// Increment distributions of the counter model
+const (
+	CounterConstant    = "constant"
+	CounterUniform     = "uniform"
+	CounterNormal      = "normal"
+	CounterExponential = "exponential"
+)
+
+// SignalSpec selects and parameterises a signal model for one or more tags.
+// Fields that do not apply to the chosen type are ignored.
+type SignalSpec struct {
+	Type         string   `json:"type"`                   // random, sequential, sine, sawtooth, square (alias step), random_walk, constant, counter, boolean, enum, fitted
+	Period       string   `json:"period,omitempty"`       // sine/sawtooth/square: Go duration, e.g. "24h". Default 1h.
+	Amplitude    *float64 `json:"amplitude,omitempty"`    // sine/sawtooth/square: half peak-to-peak. Default half the value range.
+	Offset       *float64 `json:"offset,omitempty"`       // sine/sawtooth/square: centre line. Default midpoint of the value range.
+	Phase        float64  `json:"phase,omitempty"`        // sine/sawtooth/square: phase shift in degrees
+	DutyCycle    float64  `json:"duty_cycle,omitempty"`   // square: fraction of the period spent high. Default 0.5.
+	Step         float64  `json:"step,omitempty"`         // random_walk: max change per sample as a fraction of the value range. Default 0.01.
+	Value        *float64 `json:"value,omitempty"`        // constant: the value. Default midpoint of the value range. counter: initial value. Default min.
+	Rate         *float64 `json:"rate,omitempty"`         // counter: mean increase per hour. Default: one rollover per week.
+	Distribution string   `json:"distribution,omitempty"` // counter: increment distribution (constant, uniform, normal, exponential). Default normal.
+	Rollover     *float64 `json:"rollover,omitempty"`     // counter: value at which the counter wraps back to min. Default max.
+	ResetRate    float64  `json:"reset_rate,omitempty"`   // counter: expected resets to min per day
+	// boolean/enum: state codes (boolean is always 0 and 1)
+	States []int `json:"states,omitempty"`
+	// boolean/enum: relative probabilities of moving from state i to state j (diagonal ignored). Default uniform.
+	Transitions [][]float64 `json:"transitions,omitempty"`
+	// boolean/enum: mean dwell time per state as Go durations (exponentially distributed), or one for all states. Default 1h.
+	Dwell []string `json:"dwell,omitempty"`
+	// fitted: tag whose stored fit is mimicked (see FitService). Default the generated tag itself.
+	Source string `json:"source,omitempty"`
+}
+
+// SignalModel produces the next value of a generated series. Models are stateful
+// (e.g. random walk) so one instance must be used per tag.
+type SignalModel interface {
+	Next(t time.Time) float64
+}
+
+// resumableModel is implemented by stateful models that can continue a stored series:
+// Resume sets the state as if the model had produced value at t.
+type resumableModel interface {
+	Resume(t time.Time, value float64)
+}
+
+// normalizeSignalType maps user input to a canonical signal type ("" means random).
+func normalizeSignalType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	t = strings.ReplaceAll(t, "-", "_")
+	switch t {
+	case "":
+		return SignalRandom
+	case "step":
+		return SignalSquare
+	case "randomwalk", "walk":
+		return SignalRandomWalk
+	case "bool", "digital":
+		return SignalBoolean
+	case "enumerated", "state", "markov":
+		return SignalEnum
+	}
+	return t
+}
+
+// Validate checks that the spec names a known model and has usable parameters.
+func (s SignalSpec) Validate() error {
+	switch normalizeSignalType(s.Type) {
+	case SignalRandom, SignalSequential, SignalConstant, SignalFitted:
+		return nil
+	case SignalSine, SignalSawtooth, SignalSquare:
+		if _, err := s.period(); err != nil {
+			return err
+		}
+		if s.DutyCycle < 0 || s.DutyCycle > 1 {
+			return fmt.Errorf("duty_cycle must be between 0 and 1, got %v", s.DutyCycle)
+		}
+		return nil
+	case SignalRandomWalk:
+		if s.Step < 0 || s.Step > 1 {
+			return fmt.Errorf("step must be between 0 and 1, got %v", s.Step)
+		}
+		return nil
+	case SignalCounter:
+		if s.Rate != nil && *s.Rate < 0 {
+			return fmt.Errorf("rate must not be negative, got %v", *s.Rate)
+		}
+		switch strings.ToLower(strings.TrimSpace(s.Distribution)) {
+		case "", CounterConstant, CounterUniform, CounterNormal, CounterExponential:
+		default:
+			return fmt.Errorf("unknown distribution %q", s.Distribution)
+		}
+		if s.ResetRate < 0 {
+			return fmt.Errorf("reset_rate must not be negative, got %v", s.ResetRate)
+		}
+		return nil
+	case SignalBoolean, SignalEnum:
+		_, _, _, err := s.markovParams()
+		return err
+	default:
+		return fmt.Errorf("unknown signal model type %q", s.Type)
+	}
+}
+
+// markovParams returns the state codes, transition weights and mean dwell times of a
+// boolean/enum spec, with defaults applied.
+func (s SignalSpec) markovParams() ([]int, [][]float64, []time.Duration, error) {
+	states := s.States
+	if normalizeSignalType(s.Type) == SignalBoolean {
+		if len(states) > 0 && !(len(states) == 2 && states[0] == 0 && states[1] == 1) {
+			return nil, nil, nil, fmt.Errorf("boolean states are always [0, 1]")
+		}
+		states = []int{0, 1}
+	}
+	n := len(states)
+	if n < 2 {
+		return nil, nil, nil, fmt.Errorf("states must list at least 2 state codes")
+	}
+	seen := map[int]bool{}
+	for _, st := range states {
+		if seen[st] {
+			return nil, nil, nil, fmt.Errorf("duplicate state %d", st)
+		}
+		seen[st] = true
+	}
+	trans := s.Transitions
+	if len(trans) == 0 {
+		trans = make([][]float64, n)
+		for i := range trans {
+			trans[i] = make([]float64, n)
+			for j := range trans[i] {
+				if i != j {
+					trans[i][j] = 1
+				}
+			}
+		}
+	}
+	if len(trans) != n {
+		return nil, nil, nil, fmt.Errorf("transitions must be a %dx%d matrix", n, n)
+	}
+	for i, row := range trans {
+		if len(row) != n {
+			return nil, nil, nil, fmt.Errorf("transitions must be a %dx%d matrix", n, n)
+		}
+		for j, w := range row {
+			if w < 0 {
+				return nil, nil, nil, fmt.Errorf("transitions[%d][%d] must not be negative", i, j)
+			}
+		}
+	}
+	if len(s.Dwell) != 0 && len(s.Dwell) != 1 && len(s.Dwell) != n {
+		return nil, nil, nil, fmt.Errorf("dwell must have 1 or %d values, got %d", n, len(s.Dwell))
+	}
+	dwell := make([]time.Duration, n)
+	for i := range dwell {
+		dwell[i] = time.Hour
+		var raw string
+		switch len(s.Dwell) {
+		case 1:
+			raw = s.Dwell[0]
+		case n:
+			raw = s.Dwell[i]
+		}
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid dwell %q: %w", raw, err)
+		}
+		if d < time.Second {
+			return nil, nil, nil, fmt.Errorf("dwell must be at least 1s, got %s", raw)
+		}
+		dwell[i] = d
+	}
+	return states, trans, dwell, nil
+}
+
+// IsDiscrete reports whether the spec produces state codes (boolean/enum) rather than a
+// continuous value; such series are not scaled, clamped or given noise.
+func (s SignalSpec) IsDiscrete() bool {
+	switch normalizeSignalType(s.Type) {
+	case SignalBoolean, SignalEnum:
+		return true
+	}
+	return false
+}
+
+func (s SignalSpec) period() (time.Duration, error) {
+	if strings.TrimSpace(s.Period) == "" {
+		return time.Hour, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(s.Period))
+	if err != nil {
+		return 0, fmt.Errorf("invalid period %q: %w", s.Period, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("period must be positive, got %s", s.Period)
+	}
+	return d, nil
+}
+
+// NewSignalModel builds a fresh model instance for the spec within [minValue, maxValue].
+// All randomness is drawn from rng so a seeded source reproduces the series.
+func NewSignalModel(spec SignalSpec, minValue, maxValue float64, rng *rand.Rand) (SignalModel, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	mid := (minValue + maxValue) / 2
+	half := (maxValue - minValue) / 2
+
+	switch normalizeSignalType(spec.Type) {
+	case SignalRandom:
+		return &randomModel{rng: rng, min: minValue, max: maxValue}, nil
+	case SignalSequential:
+		return &sequentialModel{rng: rng, min: minValue, max: maxValue, current: minValue + rng.Float64()*(maxValue-minValue)}, nil
+	case SignalConstant:
+		v := mid
+		if spec.Value != nil {
+			v = *spec.Value
+		}
+		return constantModel(v), nil
+	case SignalRandomWalk:
+		step := spec.Step
+		if step == 0 {
+			step = 0.01
+		}
+		return &randomWalkModel{
+			rng:     rng,
+			min:     minValue,
+			max:     maxValue,
+			step:    step * (maxValue - minValue),
+			current: minValue + rng.Float64()*(maxValue-minValue),
+		}, nil
+	case SignalCounter:
+		m := &counterModel{
+			rng:          rng,
+			min:          minValue,
+			rollover:     maxValue,
+			current:      minValue,
+			distribution: strings.ToLower(strings.TrimSpace(spec.Distribution)),
+			resetRate:    spec.ResetRate,
+		}
+		if spec.Rollover != nil {
+			if *spec.Rollover <= minValue || *spec.Rollover > maxValue {
+				return nil, fmt.Errorf("rollover (%v) must be within (min, max] = (%v, %v]", *spec.Rollover, minValue, maxValue)
+			}
+			m.rollover = *spec.Rollover
+		}
+		m.rate = (m.rollover - minValue) / (7 * 24)
+		if spec.Rate != nil {
+			m.rate = *spec.Rate
+		}
+		if spec.Value != nil {
+			if *spec.Value < minValue || *spec.Value >= m.rollover {
+				return nil, fmt.Errorf("initial value (%v) must be within [min, rollover) = [%v, %v)", *spec.Value, minValue, m.rollover)
+			}
+			m.current = *spec.Value
+		}
+		if m.distribution == "" {
+			m.distribution = CounterNormal
+		}
+		return m, nil
+	case SignalBoolean, SignalEnum:
+		states, trans, dwell, _ := spec.markovParams()
+		return &markovModel{rng: rng, states: states, transitions: trans, dwell: dwell}, nil
+	case SignalFitted:
+		return nil, fmt.Errorf("fitted model needs the stored fit of its source tag")
+	}
+
+	// Periodic models
+	period, _ := spec.period()
+	p := periodicModel{
+		kind:      normalizeSignalType(spec.Type),
+		period:    period.Seconds(),
+		amplitude: half,
+		offset:    mid,
+		phase:     spec.Phase / 360,
+		duty:      spec.DutyCycle,
+	}
+	if spec.Amplitude != nil {
+		p.amplitude = *spec.Amplitude
+	}
+	if spec.Offset != nil {
+		p.offset = *spec.Offset
+	}
+	if p.duty == 0 {
+		p.duty = 0.5
+	}
+	return &p, nil
+}
+
+// randomModel draws uniformly from [min, max] on every sample.
+type randomModel struct {
+	rng      *rand.Rand
+	min, max float64
+}
+
+func (m *randomModel) Next(time.Time) float64 {
+	return m.min + m.rng.Float64()*(m.max-m.min)
+}
+
+// sequentialModel changes by up to ±30% of the previous (clamped) value on every sample.
+type sequentialModel struct {
+	rng      *rand.Rand
+	min, max float64
+	current  float64
+}
+
+func (m *sequentialModel) Next(time.Time) float64 {
+	changePercent := (m.rng.Float64()*2 - 1) * 0.3 // -0.3 to 0.3
+	m.current = math.Max(m.min, math.Min(m.max, m.current*(1+changePercent)))
+	return m.current
+}
+
+func (m *sequentialModel) Resume(_ time.Time, value float64) {
+	m.current = math.Max(m.min, math.Min(m.max, value))
+}
+
+// randomWalkModel moves by up to ±step per sample and reflects off the range bounds.
+type randomWalkModel struct {
+	rng            *rand.Rand
+	min, max, step float64
+	current        float64
+}
+
+func (m *randomWalkModel) Next(time.Time) float64 {
+	next := m.current + (m.rng.Float64()*2-1)*m.step
+	if next > m.max {
+		next = m.max - (next - m.max)
+	}
+	if next < m.min {
+		next = m.min + (m.min - next)
+	}
+	m.current = math.Max(m.min, math.Min(m.max, next))
+	return m.current
+}
+
+func (m *randomWalkModel) Resume(_ time.Time, value float64) {
+	m.current = math.Max(m.min, math.Min(m.max, value))
+}
+
+type constantModel float64
+
+func (m constantModel) Next(time.Time) float64 {
+	return float64(m)
+}
+
+// periodicModel evaluates sine, sawtooth and square waves on absolute time, so
+// the same spec yields the same phase regardless of the generation start.
+type periodicModel struct {
+	kind      string
+	period    float64 // seconds
+	amplitude float64
+	offset    float64
+	phase     float64 // fraction of a period
+	duty      float64
+}
+
+func (m *periodicModel) Next(t time.Time) float64 {
+	secs := float64(t.UnixMilli()) / 1000
+	frac := math.Mod(secs/m.period+m.phase, 1)
+	if frac < 0 {
+		frac++
+	}
+	switch m.kind {
+	case SignalSine:
+		return m.offset + m.amplitude*math.Sin(2*math.Pi*frac)
+	case SignalSawtooth:
+		return m.offset + m.amplitude*(2*frac-1)
+	default: // square
+		if frac < m.duty {
+			return m.offset + m.amplitude
+		}
+		return m.offset - m.amplitude
+	}
+}
+
+// shapedModel reports whether seasonality and noise apply to the model's values: not to
+// state codes, nor to counters, which must stay monotonic between rollovers and resets
+func shapedModel(m SignalModel) bool {
+	switch m.(type) {
+	case *markovModel, *counterModel:
+		return false
+	}
+	return true
+}
+
+// counterModel is a monotonically increasing totalizer that wraps to min at the rollover
+// value and may be reset to min at random.
+type counterModel struct {
+	rng          *rand.Rand
+	min          float64
+	rollover     float64
+	current      float64
+	rate         float64 // mean increase per hour
+	distribution string
+	resetRate    float64 // resets per day
+	last         time.Time
+}
+
+func (m *counterModel) Next(t time.Time) float64 {
+	if m.last.IsZero() {
+		m.last = t
+		return m.current
+	}
+	hours := t.Sub(m.last).Hours()
+	m.last = t
+	if m.resetRate > 0 && m.rng.Float64() < m.resetRate*hours/24 {
+		m.current = m.min
+		return m.current
+	}
+	mean := m.rate * hours
+	inc := mean
+	switch m.distribution {
+	case CounterUniform:
+		inc = m.rng.Float64() * 2 * mean
+	case CounterNormal:
+		inc = math.Max(0, mean+m.rng.NormFloat64()*mean*0.3)
+	case CounterExponential:
+		inc = m.rng.ExpFloat64() * mean
+	}
+	m.current += inc
+	if span := m.rollover - m.min; m.current >= m.rollover {
+		m.current = m.min + math.Mod(m.current-m.min, span)
+	}
+	return m.current
+}
+
+func (m *counterModel) Resume(t time.Time, value float64) {
+	if value >= m.min && value < m.rollover {
+		m.current = value
+	}
+	m.last = t
+}
+
+// markovModel is a continuous-time Markov chain over discrete state codes: it stays in a
+// state for an exponentially distributed dwell time, then jumps to another state with the
+// state's transition weights. A state without outgoing weight is absorbing.
+type markovModel struct {
+	rng         *rand.Rand
+	states      []int
+	transitions [][]float64
+	dwell       []time.Duration
+	current     int
+	until       time.Time // end of the current dwell; zero before the first sample
+}
+
+func (m *markovModel) Next(t time.Time) float64 {
+	if m.until.IsZero() {
+		m.current = m.rng.Intn(len(m.states))
+		m.until = m.leave(t)
+	}
+	for !t.Before(m.until) {
+		m.current = m.jump()
+		m.until = m.leave(m.until)
+	}
+	return float64(m.states[m.current])
+}
+
+// Resume enters the state with code value at t (unknown codes keep the current state)
+func (m *markovModel) Resume(t time.Time, value float64) {
+	for i, code := range m.states {
+		if float64(code) == value {
+			m.current = i
+			m.until = m.leave(t)
+			return
+		}
+	}
+}
+
+// leave returns when the chain leaves the current state entered at t
+func (m *markovModel) leave(t time.Time) time.Time {
+	total := 0.0
+	for j, w := range m.transitions[m.current] {
+		if j != m.current {
+			total += w
+		}
+	}
+	if total == 0 {
+		return time.Unix(1<<40, 0) // absorbing
+	}
+	return t.Add(time.Duration(m.rng.ExpFloat64() * float64(m.dwell[m.current])))
+}
+
+// jump draws the next state from the current state's transition weights
+func (m *markovModel) jump() int {
+	row := m.transitions[m.current]
+	total := 0.0
+	for j, w := range row {
+		if j != m.current {
+			total += w
+		}
+	}
+	r := m.rng.Float64() * total
+	next := m.current
+	for j, w := range row {
+		if j == m.current || w == 0 {
+			continue
+		}
+		next = j
+		if r < w {
+			break
+		}
+		r -= w
+	}
+	return next
+}
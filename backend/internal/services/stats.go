@@ -0,0 +1,203 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"insightsim/internal/models"
+)
+
+// Statistic functions selected with the agg query parameter. Unlike the per-tag functions
+// (delta, rate, time_in_state, ...), several may be combined, e.g. agg=min,max,avg.
+const (
+	AggAvg    = "avg"    // Mean of the values in the bucket
+	AggMin    = "min"    // Smallest value
+	AggMax    = "max"    // Largest value
+	AggCount  = "count"  // Number of samples
+	AggFirst  = "first"  // Value of the earliest sample
+	AggLast   = "last"   // Value of the latest sample
+	AggStdDev = "stddev" // Sample standard deviation (0 for a single sample)
+	AggMedian = "median" // Median value
+	AggRange  = "range"  // max - min
+)
+
+// statAggs lists the statistic functions in the order used by error messages
+var statAggs = []string{AggAvg, AggMin, AggMax, AggSum, AggCount, AggFirst, AggLast, AggStdDev, AggMedian, AggRange}
+
+// IsStatAgg reports whether agg is a statistic function
+func IsStatAgg(agg string) bool {
+	for _, a := range statAggs {
+		if a == agg {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAggs parses the agg query parameter: a comma-separated list of statistic functions,
+// or a single per-tag function. Empty is sum.
+func ParseAggs(s string) ([]string, error) {
+	var aggs []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		agg := strings.ToLower(strings.TrimSpace(part))
+		if agg == "" || seen[agg] {
+			continue
+		}
+		if !IsStatAgg(agg) && !IsPerTagAgg(agg) {
+			return nil, fmt.Errorf("invalid agg %q (expected %s, or one of delta, rate, time_in_state, transitions, last_state, twa, totalize)",
+				agg, strings.Join(statAggs, ", "))
+		}
+		seen[agg] = true
+		aggs = append(aggs, agg)
+	}
+	if len(aggs) == 0 {
+		return []string{AggSum}, nil
+	}
+	if len(aggs) > 1 {
+		for _, agg := range aggs {
+			if IsPerTagAgg(agg) {
+				return nil, fmt.Errorf("agg %s cannot be combined with other functions", agg)
+			}
+		}
+	}
+	return aggs, nil
+}
+
+// needsSamples reports whether any of aggs needs the individual samples of a bucket
+// rather than the SUM/COUNT/MIN/MAX computed in SQL
+func needsSamples(aggs []string) bool {
+	for _, agg := range aggs {
+		switch agg {
+		case AggFirst, AggLast, AggStdDev, AggMedian:
+			return true
+		}
+	}
+	return false
+}
+
+// bucketStats accumulates the statistics of one bucket. Samples are added in time order.
+type bucketStats struct {
+	count   int
+	sum     float64
+	min     float64
+	max     float64
+	first   float64
+	last    float64
+	mean    float64   // Running mean (Welford) for stddev
+	m2      float64   // Sum of squared deviations from the running mean
+	values  []float64 // Kept only when the median is requested
+	quality int       // Highest quality code in the bucket
+}
+
+// add adds a sample; keepValues retains it for the median
+func (b *bucketStats) add(value float64, quality int, keepValues bool) {
+	if b.count == 0 {
+		b.min, b.max, b.first, b.quality = value, value, value, quality
+	}
+	b.count++
+	b.sum += value
+	b.min = math.Min(b.min, value)
+	b.max = math.Max(b.max, value)
+	b.last = value
+	delta := value - b.mean
+	b.mean += delta / float64(b.count)
+	b.m2 += delta * (value - b.mean)
+	if quality > b.quality {
+		b.quality = quality
+	}
+	if keepValues {
+		b.values = append(b.values, value)
+	}
+}
+
+// value returns the statistic agg of the bucket
+func (b *bucketStats) value(agg string) float64 {
+	switch agg {
+	case AggAvg:
+		return b.sum / float64(b.count)
+	case AggMin:
+		return b.min
+	case AggMax:
+		return b.max
+	case AggCount:
+		return float64(b.count)
+	case AggFirst:
+		return b.first
+	case AggLast:
+		return b.last
+	case AggStdDev:
+		if b.count < 2 {
+			return 0
+		}
+		return math.Sqrt(b.m2 / float64(b.count-1))
+	case AggMedian:
+		values := append([]float64(nil), b.values...)
+		sort.Float64s(values)
+		n := len(values)
+		if n == 0 {
+			return 0
+		}
+		if n%2 == 1 {
+			return values[n/2]
+		}
+		return (values[n/2-1] + values[n/2]) / 2
+	case AggRange:
+		return b.max - b.min
+	default: // sum
+		return b.sum
+	}
+}
+
+// statPoint returns the data point of a bucket: value is the first function of aggs and,
+// when several are requested, values holds each of them
+func statPoint(timestamp string, b *bucketStats, aggs []string) models.DataPoint {
+	p := models.DataPoint{Timestamp: timestamp, Value: b.value(aggs[0]), Quality: b.quality}
+	if len(aggs) > 1 {
+		p.Values = make(map[string]float64, len(aggs))
+		for _, agg := range aggs {
+			p.Values[agg] = b.value(agg)
+		}
+	}
+	return p
+}
+
+// statBuckets groups the time-ordered samples of one tag into buckets
+type statBuckets struct {
+	buckets bucketing
+	aggs    []string
+	median  bool
+	bucket  int64 // Start of the current bucket (ms)
+	stats   bucketStats
+	points  []models.DataPoint
+}
+
+func newStatBuckets(buckets bucketing, aggs []string) *statBuckets {
+	s := &statBuckets{buckets: buckets, aggs: aggs}
+	for _, agg := range aggs {
+		s.median = s.median || agg == AggMedian
+	}
+	return s
+}
+
+// add adds a sample, closing the current bucket when the sample falls in the next one
+func (s *statBuckets) add(millis int64, value float64, quality int) {
+	bucket := s.buckets.start(millis).UnixMilli()
+	if bucket != s.bucket && s.stats.count > 0 {
+		s.points = append(s.points, statPoint(formatTimestamp(s.bucket), &s.stats, s.aggs))
+		s.stats = bucketStats{}
+	}
+	s.bucket = bucket
+	s.stats.add(value, quality, s.median)
+}
+
+// result closes the last bucket and returns the data points
+func (s *statBuckets) result() []models.DataPoint {
+	if s.stats.count > 0 {
+		s.points = append(s.points, statPoint(formatTimestamp(s.bucket), &s.stats, s.aggs))
+		s.stats = bucketStats{}
+	}
+	return s.points
+}
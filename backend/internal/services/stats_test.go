@@ -0,0 +1,102 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAggs(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{AggSum}, false},
+		{" , ", []string{AggSum}, false},
+		{"AVG", []string{AggAvg}, false},
+		{"min, max,min ,avg", []string{AggMin, AggMax, AggAvg}, false},
+		{"delta", []string{AggDelta}, false},
+		{"twa", []string{AggTWA}, false},
+		{"mean", nil, true},
+		{"min,delta", nil, true},
+		{"twa,totalize", nil, true},
+	} {
+		got, err := ParseAggs(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseAggs(%q): err = %v", tc.in, err)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseAggs(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestBucketStatsValue(t *testing.T) {
+	var b bucketStats
+	for i, v := range []float64{4, 1, 7, 2} {
+		b.add(v, 1+i%2, true)
+	}
+	for agg, want := range map[string]float64{
+		AggSum:    14,
+		AggAvg:    3.5,
+		AggMin:    1,
+		AggMax:    7,
+		AggCount:  4,
+		AggFirst:  4,
+		AggLast:   2,
+		AggStdDev: math.Sqrt(7), // Sample variance: (0.25 + 6.25 + 12.25 + 2.25) / 3
+		AggMedian: 3,
+		AggRange:  6,
+	} {
+		if got := b.value(agg); math.Abs(got-want) > 1e-12 {
+			t.Errorf("%s = %v, want %v", agg, got, want)
+		}
+	}
+	if b.quality != 2 {
+		t.Errorf("quality = %d, want the highest (2)", b.quality)
+	}
+
+	var single bucketStats
+	single.add(5, 3, true)
+	if got := single.value(AggStdDev); got != 0 {
+		t.Errorf("stddev of a single sample = %v, want 0", got)
+	}
+	if got := single.value(AggMedian); got != 5 {
+		t.Errorf("median of a single sample = %v, want 5", got)
+	}
+}
+
+// TestStatBuckets checks that samples are grouped into their buckets and that several
+// functions fill values with value holding the first one
+func TestStatBuckets(t *testing.T) {
+	buckets := bucketing{step: int64(time.Hour / time.Millisecond)}
+	s := newStatBuckets(buckets, []string{AggMax, AggCount})
+	for _, p := range []struct {
+		ts    int64
+		value float64
+	}{
+		{t0, 1}, {t0 + 1800000, 3}, // 00:00 bucket
+		{t0 + 7200000, 5}, // 02:00 bucket; 01:00 has no samples
+	} {
+		s.add(p.ts, p.value, 3)
+	}
+	got := s.result()
+	if len(got) != 2 {
+		t.Fatalf("%d buckets, want 2: %+v", len(got), got)
+	}
+	if got[0].Timestamp != "2026-01-01T00:00:00" || got[0].Value != 3 || got[0].Values[AggCount] != 2 {
+		t.Errorf("first bucket = %+v, want max 3 and count 2 at 00:00", got[0])
+	}
+	if got[1].Timestamp != "2026-01-01T02:00:00" || got[1].Value != 5 || got[1].Values[AggMax] != 5 {
+		t.Errorf("second bucket = %+v, want max 5 at 02:00", got[1])
+	}
+
+	single := newStatBuckets(buckets, []string{AggAvg})
+	single.add(t0, 2, 3)
+	if got := single.result(); len(got) != 1 || got[0].Values != nil {
+		t.Errorf("single function: %+v, want no values map", got)
+	}
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -16,6 +18,12 @@ type TagInfo struct {
 	Source    string `json:"source"`
 }
 
+// ErrTagNotFound is returned when a tag does not exist in the tags table
+var ErrTagNotFound = errors.New("tag not found")
+
+// ErrInvalidProfile wraps validation failures of a tag generation profile
+var ErrInvalidProfile = errors.New("invalid profile")
+
 // TagsService handles tag operations (DB only)
 type TagsService struct {
 	db *database.DB
@@ -81,11 +89,20 @@ func (s *TagsService) CreateTag(tagName string, source string) error {
 	return s.db.InsertTag(tagName, now, now, source)
 }
 
-// DeleteTagData removes the tag's records from insight_raws and the tag row from tags table
+// DeleteTagData removes the tag's records from insight_raws, its anomaly labels, calculated definition, fit and the tag row from tags table
 func (s *TagsService) DeleteTagData(tag string) error {
 	if err := s.db.DeleteTagRecords(tag); err != nil {
 		return err
 	}
+	if err := s.db.DeleteTagAnomalies(tag); err != nil {
+		return err
+	}
+	if err := s.db.DeleteCalculatedTag(tag); err != nil {
+		return err
+	}
+	if err := s.db.DeleteTagFit(tag); err != nil {
+		return err
+	}
 	return s.db.DeleteTag(tag)
 }
 
@@ -93,3 +110,48 @@ func (s *TagsService) DeleteTagData(tag string) error {
 func (s *TagsService) ListTagNames() ([]string, error) {
 	return s.db.ListTagNamesFromTagsTable()
 }
+
+// GetProfile returns the generation profile of a tag (nil if the tag has none)
+func (s *TagsService) GetProfile(tag string) (*TagProfile, error) {
+	raw, found, err := s.db.GetTagProfile(tag)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrTagNotFound
+	}
+	return parseTagProfile(raw)
+}
+
+// SetProfile validates and stores the generation profile of a tag
+func (s *TagsService) SetProfile(tag string, profile *TagProfile) error {
+	if err := profile.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("encode profile: %w", err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	found, err := s.db.SetTagProfile(tag, string(data), now)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrTagNotFound
+	}
+	return nil
+}
+
+// DeleteProfile clears the generation profile of a tag
+func (s *TagsService) DeleteProfile(tag string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	found, err := s.db.SetTagProfile(tag, "", now)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrTagNotFound
+	}
+	return nil
+}
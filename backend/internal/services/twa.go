@@ -0,0 +1,153 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"insightsim/internal/database"
+	"insightsim/internal/models"
+)
+
+// Time-weighted functions selected with the agg query parameter
+const (
+	AggTWA      = "twa"      // Time-weighted average
+	AggTotalize = "totalize" // Time integral of the value, in value × per
+)
+
+// Interpolation between samples for the time-weighted functions (interp query parameter)
+const (
+	InterpLinear = "linear" // Straight line between consecutive samples
+	InterpStep   = "step"   // Each sample holds its value until the next one
+)
+
+// TimeWeighting configures the time-weighted functions
+type TimeWeighting struct {
+	Interp string        // linear or step; empty is step for discrete tags (boolean/enum), else linear
+	Per    time.Duration // Time unit of totalize, e.g. 1h for a flow in m³/h (default 1s)
+}
+
+// validate checks the options; agg is the requested function
+func (tw TimeWeighting) validate(agg string) error {
+	if tw == (TimeWeighting{}) {
+		return nil
+	}
+	if agg != AggTWA && agg != AggTotalize {
+		return fmt.Errorf("interp and per apply to agg twa and totalize only")
+	}
+	switch tw.Interp {
+	case "", InterpLinear, InterpStep:
+	default:
+		return fmt.Errorf("invalid interp %q (expected linear or step)", tw.Interp)
+	}
+	if tw.Per < 0 || (tw.Per > 0 && agg != AggTotalize) {
+		return fmt.Errorf("per applies to agg totalize only")
+	}
+	return nil
+}
+
+// interpolation returns the interpolation of a tag: the requested one, else step for
+// discrete tags and linear for the others
+func (tw TimeWeighting) interpolation(profile *TagProfile) string {
+	if tw.Interp != "" {
+		return tw.Interp
+	}
+	if profile != nil && profile.Model != nil && profile.Model.IsDiscrete() {
+		return InterpStep
+	}
+	return InterpLinear
+}
+
+// weightedBucket accumulates the time integral of one bucket
+type weightedBucket struct {
+	start    int64   // Bucket start (ms)
+	integral float64 // Sum of value × ms
+	covered  int64   // ms of the bucket with a known value
+	quality  int
+}
+
+// timeWeightedBuckets evaluates twa or totalize per bucket within [startTs, endTs], like
+// a process historian: the value between two samples is interpolated (step or linear),
+// so a bucket also uses the last sample before its start and the first one after its end.
+// prev and next are the samples just outside the range (nil if none); after the last
+// sample its value is held until endTs. Time before the first known sample is not
+// covered and does not weigh in twa. Without buckets the whole range is a single bucket.
+func timeWeightedBuckets(points []database.SeriesPoint, prev, next *database.SeriesPoint, agg, interp string, per time.Duration, buckets bucketing, startTs, endTs int64) []models.DataPoint {
+	series := make([]database.SeriesPoint, 0, len(points)+2)
+	if prev != nil {
+		series = append(series, *prev)
+	}
+	series = append(series, points...)
+	if next != nil {
+		series = append(series, *next)
+	}
+
+	var result []*weightedBucket
+	// integrate adds the segment [from, to) with the values v0 at from and v1 at to
+	integrate := func(from, to int64, v0, v1 float64, quality int) {
+		for a := from; a < to; {
+			bs, be := startTs, endTs
+			if !buckets.raw() {
+				start := buckets.start(a)
+				bs, be = start.UnixMilli(), buckets.end(start).UnixMilli()
+			}
+			b := min(be, to)
+			if n := len(result); n == 0 || result[n-1].start != bs {
+				result = append(result, &weightedBucket{start: bs})
+			}
+			w := result[len(result)-1]
+			// Trapezoid of the interpolated values at a and b
+			va := v0 + (v1-v0)*float64(a-from)/float64(to-from)
+			vb := v0 + (v1-v0)*float64(b-from)/float64(to-from)
+			w.integral += (va + vb) / 2 * float64(b-a)
+			w.covered += b - a
+			if quality > w.quality {
+				w.quality = quality
+			}
+			a = b
+		}
+	}
+	// segment integrates the part of [p.Timestamp, to) within the range
+	segment := func(p database.SeriesPoint, to int64, v1 float64) {
+		from, end := max(p.Timestamp, startTs), min(to, endTs)
+		if from >= end {
+			return
+		}
+		// Interpolated values at the clipped ends
+		v0 := p.Value + (v1-p.Value)*float64(from-p.Timestamp)/float64(to-p.Timestamp)
+		ve := p.Value + (v1-p.Value)*float64(end-p.Timestamp)/float64(to-p.Timestamp)
+		integrate(from, end, v0, ve, p.Quality)
+	}
+	for i := 0; i+1 < len(series); i++ {
+		p, q := series[i], series[i+1]
+		if q.Timestamp <= p.Timestamp {
+			continue
+		}
+		v1 := p.Value
+		if interp == InterpLinear {
+			v1 = q.Value
+		}
+		segment(p, q.Timestamp, v1)
+	}
+	if n := len(series); n > 0 && next == nil {
+		last := series[n-1]
+		segment(last, endTs, last.Value)
+	}
+
+	if per <= 0 {
+		per = time.Second
+	}
+	out := make([]models.DataPoint, 0, len(result))
+	for _, w := range result {
+		if w.covered == 0 {
+			continue
+		}
+		p := models.DataPoint{Timestamp: formatTimestamp(w.start), Quality: w.quality}
+		if agg == AggTotalize {
+			p.Value = w.integral / float64(per.Milliseconds())
+		} else {
+			p.Value = w.integral / float64(w.covered)
+		}
+		out = append(out, p)
+	}
+	return out
+}
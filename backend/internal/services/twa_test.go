@@ -0,0 +1,107 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"insightsim/internal/database"
+)
+
+func TestTimeWeightingValidate(t *testing.T) {
+	for _, tc := range []struct {
+		tw      TimeWeighting
+		agg     string
+		wantErr bool
+	}{
+		{TimeWeighting{}, AggSum, false},
+		{TimeWeighting{Interp: InterpStep}, AggTWA, false},
+		{TimeWeighting{Interp: InterpLinear, Per: time.Hour}, AggTotalize, false},
+		{TimeWeighting{Interp: InterpStep}, AggAvg, true},
+		{TimeWeighting{Interp: "cubic"}, AggTWA, true},
+		{TimeWeighting{Per: time.Hour}, AggTWA, true},
+		{TimeWeighting{Per: -time.Hour}, AggTotalize, true},
+	} {
+		if err := tc.tw.validate(tc.agg); (err != nil) != tc.wantErr {
+			t.Errorf("%+v with %s: err = %v", tc.tw, tc.agg, err)
+		}
+	}
+
+	discrete := &TagProfile{Model: &SignalSpec{Type: SignalBoolean}}
+	if got := (TimeWeighting{}).interpolation(discrete); got != InterpStep {
+		t.Errorf("discrete tag: %s, want step", got)
+	}
+	if got := (TimeWeighting{}).interpolation(nil); got != InterpLinear {
+		t.Errorf("tag without profile: %s, want linear", got)
+	}
+	if got := (TimeWeighting{Interp: InterpLinear}).interpolation(discrete); got != InterpLinear {
+		t.Errorf("requested interp: %s, want linear", got)
+	}
+}
+
+func TestTimeWeightedBuckets(t *testing.T) {
+	const minute = 60000
+	sample := func(ts int64, v float64) database.SeriesPoint {
+		return database.SeriesPoint{Timestamp: ts, Value: v, Quality: 3}
+	}
+	prev, next := sample(t0-30*minute, 0), sample(t0+90*minute, 0)
+	points := []database.SeriesPoint{sample(t0+30*minute, 60)}
+	hourly := bucketing{step: 60 * minute}
+
+	for _, tc := range []struct {
+		name       string
+		points     []database.SeriesPoint
+		prev, next *database.SeriesPoint
+		agg        string
+		interp     string
+		per        time.Duration
+		buckets    bucketing
+		endTs      int64
+		want       []float64
+	}{
+		// The value at the range boundaries is interpolated between the samples around
+		// them: 30 at both ends, 60 in the middle
+		{"linear twa", points, &prev, &next, AggTWA, InterpLinear, 0, bucketing{}, t0 + 60*minute, []float64{45}},
+		// Step holds prev's 0 until the sample
+		{"step twa", points, &prev, &next, AggTWA, InterpStep, 0, bucketing{}, t0 + 60*minute, []float64{30}},
+		{"totalize per hour", points, &prev, &next, AggTotalize, InterpLinear, time.Hour, bucketing{}, t0 + 60*minute, []float64{45}},
+		{"totalize per second", points, &prev, &next, AggTotalize, InterpStep, 0, bucketing{}, t0 + 60*minute, []float64{60 * 1800}},
+		// Before the first sample nothing is known; after the last one its value is held
+		{"no samples around", points, nil, nil, AggTWA, InterpLinear, 0, bucketing{}, t0 + 60*minute, []float64{60}},
+		{"no samples around totalize", points, nil, nil, AggTotalize, InterpLinear, time.Minute, bucketing{}, t0 + 60*minute, []float64{1800}},
+		// A segment across a bucket boundary is split at its interpolated value (60)
+		{"hourly linear", []database.SeriesPoint{sample(t0, 0), sample(t0+120*minute, 120)}, nil, nil, AggTWA, InterpLinear, 0, hourly,
+			t0 + 120*minute, []float64{30, 90}},
+		{"hourly step", []database.SeriesPoint{sample(t0, 10), sample(t0+90*minute, 20)}, nil, nil, AggTWA, InterpStep, 0, hourly,
+			t0 + 120*minute, []float64{10, 15}},
+		// A bucket without any known value is omitted
+		{"leading gap", []database.SeriesPoint{sample(t0+90*minute, 5)}, nil, nil, AggTWA, InterpLinear, 0, hourly,
+			t0 + 120*minute, []float64{5}},
+	} {
+		got := timeWeightedBuckets(tc.points, tc.prev, tc.next, tc.agg, tc.interp, tc.per, tc.buckets, t0, tc.endTs)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: %+v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i, p := range got {
+			if math.Abs(p.Value-tc.want[i]) > 1e-9 {
+				t.Errorf("%s: bucket %d = %v, want %v", tc.name, i, p.Value, tc.want[i])
+			}
+		}
+	}
+}
+
+// TestQueryTWA checks that a twa query interpolates at the range boundaries from the
+// stored samples outside the range
+func TestQueryTWA(t *testing.T) {
+	db := openTestDB(t, "A")
+	writeSeries(t, db, "A", t0-1800000, 0, 3, t0+1800000, 60, 3, t0+5400000, 0, 3)
+	out, err := NewQueryService(db).QueryTimeseriesData(QueryOptions{Start: "2026-01-01T00:00:00", End: "2026-01-01T01:00:00",
+		Tags: []string{"A"}, Aggs: []string{AggTWA}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Result["A"]; len(got) != 1 || math.Abs(got[0].Value-45) > 1e-9 || got[0].Timestamp != "2026-01-01T00:00:00" {
+		t.Errorf("twa = %+v, want 45 at 00:00", got)
+	}
+}
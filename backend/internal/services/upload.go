@@ -38,6 +38,7 @@ type ImportResult struct {
 }
 
 // ImportFromCSV parses CSV from reader and imports per mode. CSV format: header "timestamp",<tag1>,<tag2>,...; rows: timestamp,value1,value2,...
+// An optional "quality" column sets the quality code of every value on its row (empty cell = 3).
 func (u *UploadService) ImportFromCSV(reader io.Reader, mode ImportMode) (*ImportResult, error) {
 	r := csv.NewReader(reader)
 	records, err := r.ReadAll()
@@ -55,12 +56,25 @@ func (u *UploadService) ImportFromCSV(reader io.Reader, mode ImportMode) (*Impor
 		return nil, fmt.Errorf("first column must be 'timestamp', got %q", header[0])
 	}
 	tags := make([]string, 0, len(header)-1)
+	tagCols := make([]int, 0, len(header)-1)
+	qualityCol := -1
 	for i := 1; i < len(header); i++ {
 		tag := strings.TrimSpace(header[i])
 		if tag == "" {
 			return nil, fmt.Errorf("empty tag name in column %d", i+1)
 		}
+		if strings.ToLower(tag) == "quality" {
+			if qualityCol >= 0 {
+				return nil, fmt.Errorf("duplicate quality column %d", i+1)
+			}
+			qualityCol = i
+			continue
+		}
 		tags = append(tags, tag)
+		tagCols = append(tagCols, i)
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("CSV must have timestamp column and at least one tag column")
 	}
 	// data rows
 	rows := records[1:]
@@ -75,31 +89,18 @@ func (u *UploadService) ImportFromCSV(reader io.Reader, mode ImportMode) (*Impor
 		return &ImportResult{Count: 0, TagsAffected: len(tags)}, nil
 	}
 
-	conn := u.db.GetConn()
-	tx, err := conn.Begin()
-	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
+	// Values overwrite stored samples at the same timestamps regardless of quality
+	writer := u.db.NewBatchWriter(0, true)
+	defer writer.Close()
 
 	if mode == ImportModeReplace {
 		for _, tag := range tags {
-			_, err = tx.Exec("DELETE FROM insight_raws WHERE tag = ?", tag)
-			if err != nil {
+			if err := writer.Exec("DELETE FROM insight_raws WHERE tag = ?", tag); err != nil {
 				return nil, fmt.Errorf("failed to delete records for tag %s: %w", tag, err)
 			}
 		}
 	}
 
-	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO insight_raws (tag, timestamp, value, quality)
-		VALUES (?, ?, ?, ?)
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to prepare insert: %w", err)
-	}
-	defer stmt.Close()
-
 	totalCount := 0
 	for rowIdx, row := range rows {
 		if len(row) == 0 || allEmpty(row) {
@@ -116,10 +117,19 @@ func (u *UploadService) ImportFromCSV(reader io.Reader, mode ImportMode) (*Impor
 		if err != nil {
 			return nil, fmt.Errorf("row %d: %w", rowIdx+2, err)
 		}
+		quality := importQuality
+		if qualityCol >= 0 {
+			if qStr := strings.TrimSpace(row[qualityCol]); qStr != "" {
+				quality, err = strconv.Atoi(qStr)
+				if err != nil {
+					return nil, fmt.Errorf("row %d column quality: invalid integer %q: %w", rowIdx+2, qStr, err)
+				}
+			}
+		}
 		for i, tag := range tags {
 			valStr := ""
-			if i+1 < len(row) {
-				valStr = strings.TrimSpace(row[i+1])
+			if col := tagCols[i]; col < len(row) {
+				valStr = strings.TrimSpace(row[col])
 			}
 			var value float64
 			if valStr != "" {
@@ -128,16 +138,15 @@ func (u *UploadService) ImportFromCSV(reader io.Reader, mode ImportMode) (*Impor
 					return nil, fmt.Errorf("row %d column %s: invalid number %q: %w", rowIdx+2, tag, valStr, err)
 				}
 			}
-			_, err = stmt.Exec(tag, tsMs, value, importQuality)
-			if err != nil {
-				return nil, fmt.Errorf("failed to insert row: %w", err)
+			if err := writer.Write(tag, tsMs, value, quality); err != nil {
+				return nil, fmt.Errorf("row %d: %w", rowIdx+2, err)
 			}
 			totalCount++
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit: %w", err)
+	if err := writer.Commit(); err != nil {
+		return nil, err
 	}
 
 	// Ensure every CSV tag exists in tags table (create if not existed)
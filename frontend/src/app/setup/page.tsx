@@ -372,6 +372,8 @@ export default function SetupPage() {
                   }}
                   cursor="pointer"
                 >
+                  <option value="10s">1 record / 10 secs</option>
+                  <option value="30s">1 record / 30 secs</option>
                   <option value="1min">1 record / 1 min</option>
                   <option value="5min">1 record / 5 mins</option>
                   <option value="15min">1 record / 15 mins</option>
@@ -87,7 +87,7 @@ export interface GenerateStreamEvent {
   message?: string;
 }
 
-export type GenerateFrequency = '1min' | '5min' | '15min' | '30min' | '1hour';
+export type GenerateFrequency = '10s' | '30s' | '1min' | '5min' | '15min' | '30min' | '1hour';
 
 /**
  * Generate dummy data (streaming). Backend sends NDJSON: tag_complete per tag, then done or error.